@@ -0,0 +1,350 @@
+package webfinger
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores JRDs retrieved by a Client, keyed by their WebFinger query URL.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the entry stored for key, if any.
+	Get(key string) (*CacheEntry, bool)
+
+	// Set stores entry for key, replacing any existing entry.
+	Set(key string, entry *CacheEntry)
+}
+
+// CacheEntry is a JRD stored in a Cache, along with its freshness lifetime.
+type CacheEntry struct {
+	JRD *JRD
+
+	// Body is the response body the JRD was parsed from, if known.
+	Body []byte
+
+	// Expires is the time at which the entry is no longer fresh.
+	Expires time.Time
+
+	// ETag is the entity tag the server returned with the JRD, if any.  Stale
+	// entries with an ETag are revalidated using If-None-Match.
+	ETag string
+}
+
+// Fresh reports whether the entry is still fresh at time t.
+func (e *CacheEntry) Fresh(t time.Time) bool {
+	return t.Before(e.Expires)
+}
+
+// CacheMetrics receives notifications of a Client's use of its Cache, for
+// example to maintain expvar or Prometheus counters.  Implementations must be
+// safe for concurrent use.
+type CacheMetrics interface {
+	// CacheHit is called when a lookup is answered with a fresh cached JRD.
+	CacheHit()
+
+	// CacheMiss is called when a lookup finds no fresh cached JRD and must
+	// query the server, including when a stale entry is revalidated.
+	CacheMiss()
+
+	// CacheStore is called when a fetched JRD is stored in the cache.
+	CacheStore()
+}
+
+// MemoryCache is a Cache that holds entries in memory.  The zero value is an
+// empty cache ready to use.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*CacheEntry
+}
+
+// NewMemoryCache returns a new, empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{}
+}
+
+// Get returns the entry stored for key, if any.
+func (m *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	return entry, ok
+}
+
+// Set stores entry for key.
+func (m *MemoryCache) Set(key string, entry *CacheEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = make(map[string]*CacheEntry)
+	}
+	m.entries[key] = entry
+}
+
+// CachingTransport is an http.RoundTripper that caches successful responses
+// to GET requests for as long as their Cache-Control or Expires headers allow.
+// Unlike Client.Cache, it can be shared by several Clients:
+//
+//	transport := &webfinger.CachingTransport{}
+//	client := webfinger.NewClientWithTransport(transport)
+//
+// Since the cache is shared, responses marked private are not cached, nor are
+// responses to requests with an Authorization header unless they are marked
+// public.  Responses with a Vary header are only served to requests with the
+// same values for the listed headers.  Responses larger than
+// DefaultMaxResponseBytes are not cached.  Stale responses are evicted, as is
+// the response expiring soonest when the cache is full.  The zero value is
+// ready to use.
+type CachingTransport struct {
+	// Transport is the RoundTripper used to make requests that cannot be
+	// answered from the cache.  If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// MaxEntries is the maximum number of responses stored.  If zero,
+	// DefaultMaxCacheEntries is used.  If negative, there is no limit.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+}
+
+// DefaultMaxCacheEntries is the maximum number of responses stored by a
+// CachingTransport when MaxEntries is not set.
+const DefaultMaxCacheEntries = 1000
+
+// cachedResponse is a response stored by a CachingTransport.
+type cachedResponse struct {
+	status       string
+	statusCode   int
+	header       http.Header
+	body         []byte
+	uncompressed bool
+	tls          *tls.ConnectionState
+	expires      time.Time
+
+	// vary holds the values of the request headers named by the response's
+	// Vary header.
+	vary map[string]string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if req.Method != "" && req.Method != http.MethodGet {
+		return transport.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	now := time.Now()
+	entry := t.get(key, now)
+	if entry != nil && entry.matches(req) {
+		return entry.response(req), nil
+	}
+
+	res, err := transport.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+	vary, ok := sharedCacheable(req, res.Header)
+	if !ok {
+		return res, nil
+	}
+	expires, store := freshness(res.Header, nil, now)
+	if !store || !expires.After(now) {
+		return res, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, DefaultMaxResponseBytes+1))
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	if len(body) > DefaultMaxResponseBytes {
+		// too large to cache; hand back the body as read so far
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		return res, nil
+	}
+	res.Body.Close()
+
+	entry = &cachedResponse{
+		status:       res.Status,
+		statusCode:   res.StatusCode,
+		header:       res.Header.Clone(),
+		body:         body,
+		uncompressed: res.Uncompressed,
+		tls:          res.TLS,
+		expires:      expires,
+		vary:         vary,
+	}
+	t.set(key, entry, now)
+
+	return entry.response(req), nil
+}
+
+// get returns the fresh entry stored for key, if any, evicting it if it is
+// stale.
+func (t *CachingTransport) get(key string, now time.Time) *cachedResponse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := t.entries[key]
+	if entry != nil && !now.Before(entry.expires) {
+		delete(t.entries, key)
+		return nil
+	}
+	return entry
+}
+
+// set stores entry for key.  If the cache is full, stale entries are evicted,
+// and if that does not make room, so is the entry expiring soonest.
+func (t *CachingTransport) set(key string, entry *cachedResponse, now time.Time) {
+	max := t.MaxEntries
+	if max == 0 {
+		max = DefaultMaxCacheEntries
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.entries == nil {
+		t.entries = make(map[string]*cachedResponse)
+	}
+	if _, ok := t.entries[key]; !ok && max > 0 && len(t.entries) >= max {
+		var soonest string
+		for k, e := range t.entries {
+			if !now.Before(e.expires) {
+				delete(t.entries, k)
+			} else if soonest == "" || e.expires.Before(t.entries[soonest].expires) {
+				soonest = k
+			}
+		}
+		if len(t.entries) >= max {
+			delete(t.entries, soonest)
+		}
+	}
+	t.entries[key] = entry
+}
+
+// sharedCacheable reports whether a shared cache may store the response with
+// header h to req, following RFC 9111 section 3.  If so, it also returns the
+// values of the request headers named by the response's Vary header, which
+// later requests must match to be served the response.
+func sharedCacheable(req *http.Request, h http.Header) (vary map[string]string, ok bool) {
+	directives := parseCacheControl(h.Get("Cache-Control"))
+	if _, private := directives["private"]; private {
+		return nil, false
+	}
+	if req.Header.Get("Authorization") != "" {
+		if _, public := directives["public"]; !public {
+			return nil, false
+		}
+	}
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, false
+			}
+			if vary == nil {
+				vary = make(map[string]string)
+			}
+			vary[name] = strings.Join(req.Header.Values(name), ",")
+		}
+	}
+	return vary, true
+}
+
+// matches reports whether req has the same values as the request the response
+// was stored for, for each header named by the response's Vary header.
+func (e *cachedResponse) matches(req *http.Request) bool {
+	for name, value := range e.vary {
+		if strings.Join(req.Header.Values(name), ",") != value {
+			return false
+		}
+	}
+	return true
+}
+
+// response returns a new response to req with the stored status, headers,
+// body and TLS connection state.
+func (e *cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        e.status,
+		StatusCode:    e.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Uncompressed:  e.uncompressed,
+		TLS:           e.tls,
+		Request:       req,
+	}
+}
+
+// freshness returns the time until which a response with header h and body
+// jrd may be served from a cache without revalidation.  Freshness is taken
+// from the Cache-Control max-age directive, or failing that the Expires
+// header.  If the JRD carries its own expires time that is sooner, it is used
+// instead.  A zero time means the response is stale immediately.  store is
+// false if the response must not be cached at all.
+func freshness(h http.Header, jrd *JRD, now time.Time) (expires time.Time, store bool) {
+	directives := parseCacheControl(h.Get("Cache-Control"))
+	if _, noStore := directives["no-store"]; noStore {
+		return time.Time{}, false
+	}
+	if _, noCache := directives["no-cache"]; noCache {
+		return time.Time{}, true
+	}
+
+	if v, present := directives["max-age"]; present {
+		if secs, err := strconv.ParseInt(v, 10, 64); err == nil && secs >= 0 {
+			expires = now.Add(time.Duration(secs) * time.Second)
+		}
+	} else if v := h.Get("Expires"); v != "" {
+		// An invalid Expires value means the response is already stale.
+		if t, err := http.ParseTime(v); err == nil {
+			expires = t
+		}
+	}
+
+	if jrd != nil && jrd.Expires != nil {
+		if expires.IsZero() || jrd.Expires.Before(expires) {
+			expires = *jrd.Expires
+		}
+	}
+
+	return expires, true
+}
+
+// parseCacheControl parses the directives of a Cache-Control header into a
+// map of lowercased directive names to their (possibly empty) values.
+func parseCacheControl(v string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if eq := strings.Index(part, "="); eq != -1 {
+			name, value = part[:eq], strings.Trim(strings.TrimSpace(part[eq+1:]), `"`)
+		}
+		directives[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return directives
+}
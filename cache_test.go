@@ -0,0 +1,447 @@
+package webfinger
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMemoryCache(t *testing.T) {
+	var cache MemoryCache
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Get on empty cache returned ok")
+	}
+
+	entry := &CacheEntry{JRD: &JRD{Subject: "a"}}
+	cache.Set("a", entry)
+	if got, ok := cache.Get("a"); !ok || got != entry {
+		t.Errorf("Get returned %v, %v, want %v, true", got, ok, entry)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	soon := now.Add(30 * time.Second)
+	later := now.Add(time.Hour)
+
+	tests := []struct {
+		description string
+		header      http.Header
+		jrd         *JRD
+		want        time.Time
+		wantStore   bool
+	}{
+		{
+			description: "missing header",
+			header:      http.Header{},
+			jrd:         &JRD{},
+			wantStore:   true,
+		},
+		{
+			description: "max-age",
+			header:      http.Header{"Cache-Control": {"public, max-age=60"}},
+			jrd:         &JRD{},
+			want:        now.Add(60 * time.Second),
+			wantStore:   true,
+		},
+		{
+			description: "no-store",
+			header:      http.Header{"Cache-Control": {"no-store, max-age=60"}},
+			jrd:         &JRD{},
+		},
+		{
+			description: "no-cache",
+			header:      http.Header{"Cache-Control": {"no-cache"}},
+			jrd:         &JRD{},
+			wantStore:   true,
+		},
+		{
+			description: "expires header",
+			header:      http.Header{"Expires": {later.Format(http.TimeFormat)}},
+			jrd:         &JRD{},
+			want:        later,
+			wantStore:   true,
+		},
+		{
+			description: "max-age takes precedence over expires header",
+			header: http.Header{
+				"Cache-Control": {"max-age=30"},
+				"Expires":       {later.Format(http.TimeFormat)},
+			},
+			jrd:       &JRD{},
+			want:      soon,
+			wantStore: true,
+		},
+		{
+			description: "invalid expires header",
+			header:      http.Header{"Expires": {"0"}},
+			jrd:         &JRD{},
+			wantStore:   true,
+		},
+		{
+			description: "JRD expires sooner than max-age",
+			header:      http.Header{"Cache-Control": {"max-age=3600"}},
+			jrd:         &JRD{Expires: &soon},
+			want:        soon,
+			wantStore:   true,
+		},
+		{
+			description: "max-age sooner than JRD expires",
+			header:      http.Header{"Cache-Control": {"max-age=30"}},
+			jrd:         &JRD{Expires: &later},
+			want:        soon,
+			wantStore:   true,
+		},
+		{
+			description: "JRD expires only",
+			header:      http.Header{},
+			jrd:         &JRD{Expires: &later},
+			want:        later,
+			wantStore:   true,
+		},
+		{
+			description: "max-age=0",
+			header:      http.Header{"Cache-Control": {"max-age=0"}},
+			jrd:         &JRD{},
+			want:        now,
+			wantStore:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		got, store := freshness(tt.header, tt.jrd, now)
+		if !got.Equal(tt.want) || store != tt.wantStore {
+			t.Errorf("freshness(%s) returned %v, %v, want %v, %v", tt.description, got, store, tt.want, tt.wantStore)
+		}
+	}
+}
+
+func TestLookup_cache(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		wantRequests int
+	}{
+		{"max-age=60", 1},
+		{"no-store", 2},
+		{"", 2},
+	}
+
+	for _, tt := range tests {
+		client, mux, host, teardown := setup()
+		client.Cache = NewMemoryCache()
+
+		requests := 0
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if tt.cacheControl != "" {
+				w.Header().Set("Cache-Control", tt.cacheControl)
+			}
+			w.Header().Add("content-type", "application/jrd+json")
+			fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+		})
+
+		for i := 0; i < 2; i++ {
+			jrd, err := client.Lookup("acct:bob@"+host, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+			}
+			if want := (&JRD{Subject: "bob@example.com"}); !cmp.Equal(jrd, want) {
+				t.Errorf("Lookup returned %#v, want %#v", jrd, want)
+			}
+		}
+		if requests != tt.wantRequests {
+			t.Errorf("Cache-Control %q: server received %d requests, want %d", tt.cacheControl, requests, tt.wantRequests)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_notModified(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.Cache = NewMemoryCache()
+
+	requests := 0
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	first, err := client.Lookup("acct:bob@"+host, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	second, err := client.Lookup("acct:bob@"+host, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error revalidating webfinger: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Server received %d requests, want 2", requests)
+	}
+	if !cmp.Equal(first, second) {
+		t.Errorf("Lookup after 304 returned %#v, want cached JRD %#v", second, first)
+	}
+}
+
+func TestLookup_cacheReturnsCopies(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.Cache = NewMemoryCache()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com","links":[{"rel":"self","href":"https://example.com/bob"}]}`)
+	})
+
+	want := &JRD{Subject: "bob@example.com", Links: []Link{{Rel: "self", Href: "https://example.com/bob"}}}
+	for i := 0; i < 3; i++ {
+		jrd, err := client.Lookup("acct:bob@"+host, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+		}
+		if !cmp.Equal(jrd, want) {
+			t.Errorf("Lookup %d returned %#v, want %#v", i, jrd, want)
+		}
+		jrd.Subject = "changed"
+		jrd.Links[0].Href = "changed"
+	}
+}
+
+func TestLookup_notModifiedWithoutCache(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+
+	_, err := client.Lookup("acct:bob@"+host, nil)
+	if err == nil {
+		t.Error("Expected error for unsolicited 304 response")
+	}
+}
+
+type countingMetrics struct {
+	hits, misses, stores int64
+}
+
+func (m *countingMetrics) CacheHit()   { atomic.AddInt64(&m.hits, 1) }
+func (m *countingMetrics) CacheMiss()  { atomic.AddInt64(&m.misses, 1) }
+func (m *countingMetrics) CacheStore() { atomic.AddInt64(&m.stores, 1) }
+
+func TestLookup_cacheMetrics(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.Cache = NewMemoryCache()
+	metrics := new(countingMetrics)
+	client.CacheMetrics = metrics
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+			t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+		}
+	}
+	if want := (countingMetrics{hits: 1, misses: 1, stores: 1}); *metrics != want {
+		t.Errorf("Cache metrics are %+v, want %+v", *metrics, want)
+	}
+}
+
+func TestCachingTransport(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		wantRequests int
+	}{
+		{"max-age=60", 1},
+		{"no-store", 3},
+		{"", 3},
+	}
+
+	for _, tt := range tests {
+		var requests int64
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests, 1)
+			if tt.cacheControl != "" {
+				w.Header().Set("Cache-Control", tt.cacheControl)
+			}
+			w.Header().Add("content-type", "application/jrd+json")
+			fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+		}))
+		u, _ := url.Parse(server.URL)
+
+		transport := &CachingTransport{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		}
+		// the transport is shared by separate clients
+		for i := 0; i < 3; i++ {
+			client := NewClientWithTransport(transport)
+			jrd, err := client.Lookup("acct:bob@"+u.Host, nil)
+			if err != nil {
+				t.Fatalf("Cache-Control %q: Lookup returned error: %v", tt.cacheControl, err)
+			}
+			if want := (&JRD{Subject: "bob@example.com"}); !cmp.Equal(jrd, want) {
+				t.Errorf("Cache-Control %q: Lookup returned %#v, want %#v", tt.cacheControl, jrd, want)
+			}
+		}
+		if got := atomic.LoadInt64(&requests); got != int64(tt.wantRequests) {
+			t.Errorf("Cache-Control %q: server received %d requests, want %d", tt.cacheControl, got, tt.wantRequests)
+		}
+		server.Close()
+	}
+}
+
+func TestCachingTransport_shared(t *testing.T) {
+	tests := []struct {
+		description  string
+		cacheControl string
+		vary         string
+		header       string
+		wantShared   bool
+	}{
+		{"private", "private, max-age=60", "", "", false},
+		{"authorization", "max-age=60", "", "Authorization", false},
+		{"public authorization", "public, max-age=60", "", "Authorization", true},
+		{"vary", "max-age=60", "X-Tenant", "X-Tenant", false},
+		{"vary other header", "max-age=60", "Accept-Language", "X-Tenant", true},
+		{"vary star", "max-age=60", "*", "", false},
+	}
+
+	for _, tt := range tests {
+		var requests int64
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests, 1)
+			w.Header().Set("Cache-Control", tt.cacheControl)
+			if tt.vary != "" {
+				w.Header().Set("Vary", tt.vary)
+			}
+			w.Header().Add("content-type", "application/jrd+json")
+			subject := "acct:anonymous@example.com"
+			if tt.header != "" && r.Header.Get(tt.header) != "" {
+				subject = "acct:bob@example.com"
+			}
+			fmt.Fprintf(w, `{"subject":%q}`, subject)
+		}))
+		u, _ := url.Parse(server.URL)
+
+		transport := &CachingTransport{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		}
+		authenticated := NewClientWithTransport(transport)
+		authenticated.RequestModifier = func(req *http.Request) error {
+			if tt.header != "" {
+				req.Header.Set(tt.header, "secret")
+			}
+			return nil
+		}
+		if _, err := authenticated.Lookup("acct:bob@"+u.Host, nil); err != nil {
+			t.Fatalf("%s: Lookup returned error: %v", tt.description, err)
+		}
+
+		anonymous := NewClientWithTransport(transport)
+		jrd, err := anonymous.Lookup("acct:bob@"+u.Host, nil)
+		if err != nil {
+			t.Fatalf("%s: Lookup returned error: %v", tt.description, err)
+		}
+		if got, want := atomic.LoadInt64(&requests) == 1, tt.wantShared; got != want {
+			t.Errorf("%s: second client served from cache is %v, want %v", tt.description, got, want)
+		}
+		if !tt.wantShared && jrd.Subject != "acct:anonymous@example.com" {
+			t.Errorf("%s: second client was served subject %q", tt.description, jrd.Subject)
+		}
+		server.Close()
+	}
+}
+
+func TestCachingTransport_tls(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	transport := &CachingTransport{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	for i := 0; i < 2; i++ {
+		client := NewClientWithTransport(transport)
+		client.VerifyInsecureResponse = func(res *http.Response) error {
+			t.Errorf("VerifyInsecureResponse called for HTTPS response (lookup %d)", i)
+			return nil
+		}
+		if _, err := client.Lookup("acct:bob@"+u.Host, nil); err != nil {
+			t.Fatalf("Lookup returned error: %v", err)
+		}
+	}
+}
+
+func TestCachingTransport_eviction(t *testing.T) {
+	var requests []string
+	transport := &CachingTransport{
+		MaxEntries: 2,
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			requests = append(requests, req.URL.Path)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Cache-Control": {"max-age=" + strings.TrimPrefix(req.URL.Path, "/")}},
+				Body:       io.NopCloser(strings.NewReader("{}")),
+				Request:    req,
+			}, nil
+		}),
+	}
+	get := func(path string) {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com"+path, nil)
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip(%s) returned error: %v", path, err)
+		}
+		res.Body.Close()
+	}
+
+	// the cache is full, so the entry expiring soonest is evicted
+	get("/60")
+	get("/30")
+	get("/90")
+	if got := len(transport.entries); got != 2 {
+		t.Errorf("transport has %d entries, want 2", got)
+	}
+	requests = nil
+	get("/60")
+	get("/90")
+	get("/30")
+	if want := []string{"/30"}; !cmp.Equal(requests, want) {
+		t.Errorf("transport requested %q, want %q", requests, want)
+	}
+
+	// stale entries are evicted when they are looked up
+	transport.entries["https://example.com/90"].expires = time.Now().Add(-time.Second)
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/90", nil)
+	if entry := transport.get(req.URL.String(), time.Now()); entry != nil {
+		t.Error("get returned a stale entry")
+	}
+	if _, ok := transport.entries["https://example.com/90"]; ok {
+		t.Error("stale entry was not evicted")
+	}
+}
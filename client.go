@@ -1,5 +1,5 @@
 // Package webfinger provides a simple client implementation of the WebFinger
-// protocol.
+// protocol, along with an http.Handler for serving WebFinger queries.
 //
 // It is a work in progress, the API is not frozen.
 // We're trying to catchup with the last draft of the protocol:
@@ -20,7 +20,7 @@
 //	        email := os.Args[1]
 //
 //	        client := webfinger.NewClient(nil)
-//	        client.AllowHTTP = true
+//	        client.TransportMode = webfinger.HTTPSWithFallback
 //
 //	        jrd, err := client.Lookup(email, nil)
 //	        if err != nil {
@@ -33,20 +33,49 @@
 package webfinger
 
 import (
-	"errors"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/encoding/htmlindex"
 )
 
+// Version is the version of this package, used in the default User-Agent.
+const Version = "0.1.0"
+
+// DefaultUserAgent is the User-Agent sent by a Client with no UserAgent set.
+const DefaultUserAgent = "go-webfinger/" + Version
+
+// jrdMediaType is the media type of a JRD document.
+const jrdMediaType = "application/jrd+json"
+
+// webFingerPath is the well-known path of the WebFinger query endpoint.
+const webFingerPath = "/.well-known/webfinger"
+
 // Resource is a resource for which a WebFinger query can be issued.
 type Resource url.URL
 
 // Parse parses rawurl into a WebFinger Resource.  The rawurl should be an
 // absolute URL, or an email-like identifier (e.g. "bob@example.com").
+//
+// Characters not permitted in the user part of an acct URL are
+// percent-encoded, so "juliet@capulet.example@shoppingsite.example" and
+// "acct:juliet%40capulet.example@shoppingsite.example" parse to the same
+// Resource.  Characters that are already percent-encoded are left as is.
 func Parse(rawurl string) (*Resource, error) {
 	u, err := url.Parse(rawurl)
 	if err != nil {
@@ -62,72 +91,598 @@ func Parse(rawurl string) (*Resource, error) {
 		return Parse("acct:" + rawurl)
 	}
 
+	if u.Scheme == "acct" && u.Opaque != "" {
+		if at := strings.LastIndex(u.Opaque, "@"); at != -1 {
+			u.Opaque = escapeUserpart(u.Opaque[:at]) + u.Opaque[at:]
+		}
+	}
+
 	r := Resource(*u)
 	return &r, nil
 }
 
+// DefaultSchemes are the resource URI schemes accepted by ParseStrict when no
+// schemes are specified.
+var DefaultSchemes = []string{"acct", "mailto", "http", "https", "tel"}
+
+// ParseStrict is like Parse, but rejects resources whose scheme is not one of
+// schemes, or of DefaultSchemes if none are given.  Email-like identifiers are
+// treated as acct URLs, as with Parse.  The error for a rejected scheme wraps
+// ErrUnsupportedScheme.
+func ParseStrict(rawurl string, schemes ...string) (*Resource, error) {
+	r, err := Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	for _, scheme := range schemes {
+		if strings.EqualFold(r.Scheme, scheme) {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupportedScheme, r.Scheme)
+}
+
+// escapeUserpart percent-encodes the characters of an acct URL's userpart
+// that RFC 7565 does not permit unencoded, notably "@".  Existing
+// percent-encoded octets are left as is, so escaping is idempotent.
+func escapeUserpart(s string) string {
+	return percentEncode(s, "-._~!$&'()*+,;=%")
+}
+
+// percentEncode percent-encodes all bytes of s other than ASCII letters,
+// digits, and the bytes in allowed.
+func percentEncode(s string, allowed string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte(allowed, c) != -1 {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
 // WebFingerHost returns the default host for issuing WebFinger queries for
 // this resource.  For Resource URLs with a host component, that value is used.
 // For URLs that do not have a host component, the host is determined by other
 // mains if possible (for example, the domain in the addr-spec of a mailto
-// URL).  If the host cannot be determined from the URL, this value will be an
-// empty string.
+// URL, the domain name phone-context of a local tel URL, or the authority of
+// an opaque part beginning with "//").  If the host
+// cannot be determined from the URL, as for a global tel URL such as
+// "tel:+1-816-555-1212", this value will be an empty string; such resources
+// can only be looked up by querying an explicitly chosen host.
+//
+// The domain of an acct or mailto URL may include a port, as in
+// "acct:bob@example.com:8443", in which case the port is kept in the returned
+// host and queries are sent to it.  If the port is not a valid port number,
+// the host cannot be determined and an empty string is returned.
+//
+// Since hosts are case-insensitive, the returned host is always lowercase.
+// The trailing dot of a fully-qualified domain name, as in
+// "bob@example.com.", is removed so that the host matches TLS certificates.
 func (r *Resource) WebFingerHost() string {
+	return trimRootDot(r.webFingerHost())
+}
+
+// webFingerHost returns the WebFinger host of r, as described for
+// WebFingerHost, without removing a trailing dot.
+func (r *Resource) webFingerHost() string {
 	if r.Host != "" {
-		return r.Host
-	} else if r.Scheme == "acct" || r.Scheme == "mailto" {
+		return strings.ToLower(r.Host)
+	} else if kind := r.Kind(); kind == KindAccount || kind == KindMailto {
 		at := strings.LastIndex(r.Opaque, "@")
 		if at != -1 {
-			return r.Opaque[at+1:]
+			return domainHost(r.Opaque[at+1:])
+		}
+	} else if r.Scheme == "tel" {
+		// RFC 3966 section 5.1.5: the phone-context of a local number is
+		// either a domain name or a global number prefix beginning with "+".
+		for _, param := range strings.Split(r.Opaque, ";")[1:] {
+			if kv := strings.SplitN(param, "=", 2); len(kv) == 2 && strings.EqualFold(kv[0], "phone-context") {
+				if !strings.HasPrefix(kv[1], "+") {
+					return strings.ToLower(kv[1])
+				}
+			}
+		}
+	} else if strings.HasPrefix(r.Opaque, "//") {
+		// An opaque part with "//authority" syntax, as in a Resource built
+		// from a url.URL with Opaque set rather than Host.
+		authority := r.Opaque[2:]
+		if end := strings.IndexAny(authority, "/?#"); end != -1 {
+			authority = authority[:end]
+		}
+		if at := strings.LastIndex(authority, "@"); at != -1 {
+			authority = authority[at+1:]
+		}
+		if authority != "" {
+			return domainHost(authority)
 		}
 	}
 	return ""
 }
 
+// trimRootDot removes a single trailing dot from the host name in host, which
+// may include a port.
+func trimRootDot(host string) string {
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		if strings.HasSuffix(hostname, ".") {
+			return net.JoinHostPort(strings.TrimSuffix(hostname, "."), port)
+		}
+		return host
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// domainHost returns the lowercased host of the domain part of an acct or
+// mailto URL, which may include a port.  An empty string is returned if the
+// port is invalid.
+func domainHost(domain string) string {
+	if colon := strings.LastIndex(domain, ":"); colon != -1 && !strings.HasSuffix(domain, "]") {
+		port, err := strconv.ParseUint(domain[colon+1:], 10, 16)
+		if colon == 0 || err != nil || port == 0 {
+			return ""
+		}
+	}
+	return strings.ToLower(domain)
+}
+
+// Kind classifies a Resource by its URI scheme.
+type Kind int
+
+const (
+	// KindOther is any resource not covered by another Kind, such as a tel
+	// or file URL.
+	KindOther Kind = iota
+
+	// KindAccount is an acct URL, such as "acct:bob@example.com".  Parse
+	// treats email-like identifiers as acct URLs.
+	KindAccount
+
+	// KindHTTPURL is an http or https URL.
+	KindHTTPURL
+
+	// KindMailto is a mailto URL, such as "mailto:bob@example.com".
+	KindMailto
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindOther:
+		return "Other"
+	case KindAccount:
+		return "Account"
+	case KindHTTPURL:
+		return "HTTPURL"
+	case KindMailto:
+		return "Mailto"
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Kind returns the kind of resource r is, based on its scheme.
+func (r *Resource) Kind() Kind {
+	switch strings.ToLower(r.Scheme) {
+	case "acct":
+		return KindAccount
+	case "http", "https":
+		return KindHTTPURL
+	case "mailto":
+		return KindMailto
+	}
+	return KindOther
+}
+
+// Account returns the user and host parts of an acct URL, such as "bob" and
+// "example.com" for "acct:bob@example.com".  The user part is
+// percent-decoded, so "acct:juliet%40capulet.example@shoppingsite.example"
+// has user "juliet@capulet.example".  ok is false if the Resource is not a
+// valid acct URL.
+func (r *Resource) Account() (user, host string, ok bool) {
+	if r.Kind() != KindAccount {
+		return "", "", false
+	}
+	at := strings.LastIndex(r.Opaque, "@")
+	if at < 1 || at == len(r.Opaque)-1 {
+		return "", "", false
+	}
+	user, err := url.PathUnescape(r.Opaque[:at])
+	if err != nil {
+		return "", "", false
+	}
+	return user, r.Opaque[at+1:], true
+}
+
 // String reassembles the Resource into a valid URL string.
 func (r *Resource) String() string {
 	u := url.URL(*r)
 	return u.String()
 }
 
+// MarshalText implements encoding.TextMarshaler, encoding the Resource in its
+// String form.
+func (r *Resource) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, parsing text with Parse.
+// Email-like identifiers such as "bob@example.com" are accepted.
+func (r *Resource) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*r = *parsed
+	return nil
+}
+
+// Normalize returns a copy of the Resource with its case-insensitive parts,
+// the scheme and host, converted to lowercase.  For acct and mailto URLs, the
+// host is the part following the last "@"; the local part preceding it is
+// case-sensitive and left as is.
+func (r *Resource) Normalize() *Resource {
+	n := *r
+	n.Scheme = strings.ToLower(r.Scheme)
+	n.Host = strings.ToLower(r.Host)
+	if n.Scheme == "acct" || n.Scheme == "mailto" {
+		if at := strings.LastIndex(r.Opaque, "@"); at != -1 {
+			n.Opaque = r.Opaque[:at+1] + strings.ToLower(r.Opaque[at+1:])
+		}
+	}
+	return &n
+}
+
+// Equal reports whether r and other identify the same resource.  They are
+// compared after normalization: schemes and hosts are compared
+// case-insensitively, other parts (such as the user part of an acct URL)
+// case-sensitively, and percent-encoding is canonicalized, so
+// "acct:Bob@Example.COM" equals "acct:%42ob@example.com".
+func (r *Resource) Equal(other *Resource) bool {
+	if r == nil || other == nil {
+		return r == other
+	}
+	return canonicalEscapes(r.Normalize().String()) == canonicalEscapes(other.Normalize().String())
+}
+
+// canonicalEscapes returns s with percent-encoded unreserved characters
+// decoded, and all other percent-encodings in uppercase.
+func canonicalEscapes(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) != -1 {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&15])
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
 // JRDURL returns the WebFinger query URL for this resource. If rels is
-// specified, it will be included in the query URL.
+// specified, it will be included in the query URL as repeated rel
+// parameters, in the order given and with duplicates removed.
+// Internationalized host names are converted to their ASCII (punycode) form
+// for the query URL, but the resource itself is left as is.
+//
+// JRDURL does not apply any Client options; use Client.PlanLookup for the URL
+// a Client would query, with its scheme, port and path overrides applied.
 func (r *Resource) JRDURL(rels []string) *url.URL {
 	return &url.URL{
 		Scheme: "https",
-		Host:   r.WebFingerHost(),
-		Path:   "/.well-known/webfinger",
+		Host:   asciiHost(r.WebFingerHost()),
+		Path:   webFingerPath,
 		RawQuery: url.Values{
 			"resource": []string{r.String()},
-			"rel":      rels,
+			"rel":      uniqueRels(rels),
 		}.Encode(),
 	}
 }
 
+// uniqueRels returns rels with duplicates removed, keeping the first
+// occurrence of each.
+func uniqueRels(rels []string) []string {
+	seen := make(map[string]bool, len(rels))
+	unique := make([]string, 0, len(rels))
+	for _, rel := range rels {
+		if !seen[rel] {
+			seen[rel] = true
+			unique = append(unique, rel)
+		}
+	}
+	return unique
+}
+
+// asciiHost converts the host name in host, which may include a port, to its
+// ASCII form as used in DNS.  If the host name cannot be converted, host is
+// returned unchanged.
+func asciiHost(host string) string {
+	name, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		name, port = h, p
+	}
+	ascii, err := idna.Lookup.ToASCII(name)
+	if err != nil {
+		return host
+	}
+	if port != "" {
+		return net.JoinHostPort(ascii, port)
+	}
+	return ascii
+}
+
 // A Client is a WebFinger client.
 type Client struct {
 	// HTTP client used to perform WebFinger lookups.
 	client *http.Client
 
-	// Allow the use of HTTP endoints for lookups.  The WebFinger spec requires
-	// all lookups be performed over HTTPS, so this should only ever be enabled
-	// for development.
+	// TransportMode controls whether plain HTTP may be used for lookups.  The
+	// zero value, HTTPSOnly, permits HTTPS only.
+	TransportMode TransportMode
+
+	// Allow the use of HTTP endoints for lookups.  If set and TransportMode is
+	// HTTPSOnly, the client behaves as if TransportMode were
+	// HTTPSWithFallback.
+	//
+	// Deprecated: set TransportMode instead.
 	AllowHTTP bool
 
-	// Logger used during webfinger fetching.
+	// Log, if non-nil, is used to log the progress of lookups.  If nil, no
+	// logging is performed unless Logger is set.
+	Log LeveledLogger
+
+	// Logger, if non-nil and Log is nil, is used to log the progress of
+	// lookups, including debug messages.
+	//
+	// Deprecated: use Log with a StdLogger instead.
 	Logger *log.Logger
+
+	// Accept is the value of the Accept header sent with WebFinger requests.
+	// If empty, "application/jrd+json" is used.
+	Accept string
+
+	// Timeout, if non-zero, limits the time taken by each lookup, including
+	// any retries, redirects and reading the response.  If the lookup's
+	// context has an earlier deadline, that deadline applies instead.
+	Timeout time.Duration
+
+	// Port, if non-zero, is the port WebFinger queries are sent to, replacing
+	// any port derived from the resource.  This is useful for development
+	// servers and non-standard deployments.
+	Port int
+
+	// UseSRV enables delegation of WebFinger queries using DNS SRV records.
+	// If set, the _webfinger._tcp SRV record of the resource's host is looked
+	// up, and if present, queries are sent to its target and port instead.
+	// SRV records are not consulted when an explicit host is given, or by
+	// PlanLookup.
+	UseSRV bool
+
+	// DNSResolver, if non-nil, is used to resolve host names and look up
+	// SRV records.  Host names are only resolved with it if the http.Client
+	// uses an *http.Transport.  If nil, net.DefaultResolver is used.
+	DNSResolver DNSResolver
+
+	// WellKnownPath, if non-empty, is the path WebFinger queries are sent to
+	// in place of "/.well-known/webfinger".  This is useful behind reverse
+	// proxies and in tests.
+	WellKnownPath string
+
+	// MaxRedirects is the maximum number of redirects followed for a single
+	// request.  If zero, up to 10 redirects are followed, or the redirect
+	// policy of the provided http.Client is used.  If negative, no redirects
+	// are followed.
+	MaxRedirects int
+
+	// RedirectGuard, if non-nil, is called before each redirect is followed,
+	// with the redirected request and the requests made so far, oldest
+	// first.  If it returns an error, the redirect is not followed and the
+	// lookup fails with a *RedirectError wrapping that error.  It can be used
+	// to reject redirects to private or internal hosts.  Redirects from HTTPS
+	// to HTTP are rejected before RedirectGuard is called, as set by
+	// TransportMode.
+	RedirectGuard func(req *http.Request, via []*http.Request) error
+
+	// HostPolicy, if non-nil, is called with the host name (without port) of
+	// each WebFinger, host-meta and lrdd URL before it is requested, after
+	// any SRV lookup.  If it returns an error, the request is not made and
+	// the lookup fails with a *HostPolicyError wrapping that error.  It can
+	// be used to deny lookups of hosts by name, such as "localhost", or by
+	// IP literal, such as "169.254.169.254".  Since it sees only the host
+	// name and not the addresses it resolves to, it does not protect against
+	// names that resolve to internal addresses; use a DNSResolver or a
+	// dialer in the http.Client's Transport that checks resolved addresses
+	// for that.
+	// Redirects are checked by RedirectGuard instead.
+	HostPolicy func(host string) error
+
+	// RetryPolicy, if non-nil, controls retrying of requests that fail with
+	// a network error or transient HTTP status.
+	RetryPolicy *RetryPolicy
+
+	// VerifySubject requires that the subject or one of the aliases of a
+	// returned JRD be the queried resource, as compared by Resource.Equal.  If
+	// not, a *SubjectMismatchError is returned.
+	VerifySubject bool
+
+	// QueryRelsSeparately works around servers that only honour the first
+	// rel of a query.  If set and a lookup for several rels returns no links
+	// for some of them, each missing rel is queried separately and the
+	// results are merged with JRD.Merge.  Rels whose separate queries fail
+	// are left missing.  Since a merged JRD was not parsed from a single
+	// response, LookupRaw returns a nil body for it.
+	QueryRelsSeparately bool
+
+	// FilterRels removes links from returned JRDs whose rel was not
+	// requested, for servers that ignore the rel query parameter.
+	FilterRels bool
+
+	// AllowHostMeta enables falling back to legacy host-meta discovery (RFC
+	// 6415) when a server does not support WebFinger queries.
+	AllowHostMeta bool
+
+	// UserAgent is the value of the User-Agent header sent with WebFinger
+	// requests.  If empty, DefaultUserAgent is used.
+	UserAgent string
+
+	// RequireUTF8 rejects responses whose Content-Type names a charset other
+	// than UTF-8, as the WebFinger spec requires.  Otherwise, such responses
+	// are transcoded to UTF-8 before parsing.
+	RequireUTF8 bool
+
+	// IgnoreContentType disables the check that responses are served with an
+	// acceptable content type, for servers that return valid JRDs with the
+	// wrong type.
+	IgnoreContentType bool
+
+	// AcceptableContentTypes lists the media types accepted for JRD
+	// responses, such as "application/ld+json" for servers that label JRDs
+	// with it.  Media types are compared case-insensitively, ignoring
+	// parameters.  If empty, DefaultContentTypes is used.
+	AcceptableContentTypes []string
+
+	// Concurrency is the maximum number of lookups LookupAll performs at
+	// once.  If zero or negative, DefaultConcurrency is used.
+	Concurrency int
+
+	// Cache, if non-nil, is used to store fetched JRDs for as long as the
+	// server's caching headers allow.  Stale JRDs that were served with an
+	// ETag are revalidated with a conditional request.  Lookups return copies
+	// of cached JRDs, so callers may modify them freely.
+	Cache Cache
+
+	// CacheMetrics, if non-nil, is notified of each Cache hit, miss and store.
+	CacheMetrics CacheMetrics
+
+	// MaxResponseBytes is the maximum size of a response body that is read.
+	// Larger responses fail with a *ResponseTooLargeError.  If zero,
+	// DefaultMaxResponseBytes is used.  If negative, there is no limit.
+	MaxResponseBytes int64
+
+	// RequestModifier, if non-nil, is called with each HTTP request just
+	// before it is sent, including retries and host-meta requests, so that
+	// callers can add headers such as Authorization.  If it returns an error,
+	// the lookup fails with that error.
+	RequestModifier func(req *http.Request) error
+
+	// VerifyInsecureResponse, if non-nil, is called with each response that
+	// was not received over HTTPS, such as when TransportMode permits plain
+	// HTTP, to verify it by other means, for example an HTTP Signature.
+	// The response body can be read in full.  If it returns an error, the
+	// lookup fails with that error.  By default, no verification is done.
+	VerifyInsecureResponse func(res *http.Response) error
+
+	// OnRequestStart, if non-nil, is called with the URL of each HTTP request
+	// before it is sent, including retries and host-meta requests.  It can be
+	// used to record tracing spans or metrics.
+	OnRequestStart func(u *url.URL)
+
+	// OnRequestEnd, if non-nil, is called when each HTTP request started with
+	// OnRequestStart has received a response or failed.  Both hooks may be
+	// called concurrently by LookupAll and during host-meta discovery.
+	OnRequestEnd func(info RequestInfo)
+
+	// resolving holds the transport that resolves host names with
+	// DNSResolver.  It is a pointer so that a Client may be copied.
+	resolving *resolvingTransport
+}
+
+// DefaultConcurrency is the number of concurrent lookups performed by
+// LookupAll when Client.Concurrency is not set.
+const DefaultConcurrency = 8
+
+// DefaultMaxResponseBytes is the maximum size of a response body read when
+// Client.MaxResponseBytes is not set.
+const DefaultMaxResponseBytes = 1 << 20
+
+// DefaultClient is the default Client and is used by Lookup and the other
+// package-level lookup functions.  It uses http.DefaultClient with the zero
+// value of every setting: HTTPS only, no cache, no retries and no logging.
+//
+// Since it is shared by all users of the package-level functions, it should
+// not be modified in place.  Use SetDefaultClient to replace it instead.
+var DefaultClient = NewClient(nil)
+
+// defaultClientMu guards DefaultClient against concurrent replacement.
+var defaultClientMu sync.RWMutex
+
+// SetDefaultClient replaces DefaultClient with c, so that it is used by Lookup
+// and the other package-level lookup functions.  If c is nil, a new Client
+// with the default settings is installed.
+func SetDefaultClient(c *Client) {
+	if c == nil {
+		c = NewClient(nil)
+	}
+	defaultClientMu.Lock()
+	defer defaultClientMu.Unlock()
+	DefaultClient = c
 }
 
-// DefaultClient is the default Client and is used by Lookup.
-var DefaultClient = &Client{
-	client: http.DefaultClient,
+// defaultClient returns the current DefaultClient.
+func defaultClient() *Client {
+	defaultClientMu.RLock()
+	defer defaultClientMu.RUnlock()
+	return DefaultClient
 }
 
 // Lookup returns the JRD for the specified identifier.
 //
 // Lookup is a wrapper around DefaultClient.Lookup.
 func Lookup(identifier string, rels []string) (*JRD, error) {
-	return DefaultClient.Lookup(identifier, rels)
+	return defaultClient().Lookup(identifier, rels)
+}
+
+// LookupContext is like Lookup, but the lookup is bound to ctx.
+//
+// LookupContext is a wrapper around DefaultClient.LookupContext.
+func LookupContext(ctx context.Context, identifier string, rels []string) (*JRD, error) {
+	return defaultClient().LookupContext(ctx, identifier, rels)
+}
+
+// LookupResource returns the JRD for the specified Resource.
+//
+// LookupResource is a wrapper around DefaultClient.LookupResource.
+func LookupResource(resource *Resource, rels []string) (*JRD, error) {
+	return defaultClient().LookupResource(resource, rels)
+}
+
+// LookupResourceContext is like LookupResource, but the lookup is bound to
+// ctx.
+//
+// LookupResourceContext is a wrapper around
+// DefaultClient.LookupResourceContext.
+func LookupResourceContext(ctx context.Context, resource *Resource, rels []string) (*JRD, error) {
+	return defaultClient().LookupResourceContext(ctx, resource, rels)
 }
 
 // NewClient returns a new WebFinger Client.  If a nil http.Client is provied,
@@ -137,64 +692,786 @@ func NewClient(httpClient *http.Client) *Client {
 		httpClient = http.DefaultClient
 	}
 	return &Client{
-		client: httpClient,
+		client:    httpClient,
+		resolving: &resolvingTransport{},
 	}
 }
 
+// NewClientWithTransport returns a new WebFinger Client that sends requests
+// with rt, such as a RoundTripper adding authentication or tracing.  If rt
+// is nil, http.DefaultTransport is used.
+func NewClientWithTransport(rt http.RoundTripper) *Client {
+	return NewClient(&http.Client{Transport: rt})
+}
+
 // Lookup returns the JRD for the specified identifier.  If provided, only the
 // specified rel values will be requested, though WebFinger servers are not
 // obligated to respect that request.
 func (c *Client) Lookup(identifier string, rels []string) (*JRD, error) {
+	return c.LookupContext(context.Background(), identifier, rels)
+}
+
+// PlanLookup returns the URL that Lookup would query for the specified
+// identifier and rels, with the client's host, port and path overrides
+// applied, without performing the lookup.  Host-meta fallback and redirects
+// may cause further URLs to be requested.
+func (c *Client) PlanLookup(identifier string, rels []string) (*url.URL, error) {
+	resource, err := Parse(identifier)
+	if err != nil {
+		return nil, err
+	}
+	u := c.jrdURL(resource, "", rels)
+	if u.Host == "" {
+		return nil, fmt.Errorf("cannot determine WebFinger host for %s", resource)
+	}
+	return u, nil
+}
+
+// LookupContext is like Lookup, but the lookup is bound to ctx.  If ctx is
+// cancelled or its deadline expires before the lookup completes, ctx.Err() is
+// returned.
+func (c *Client) LookupContext(ctx context.Context, identifier string, rels []string) (*JRD, error) {
 	resource, err := Parse(identifier)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.LookupResource(resource, rels)
+	return c.LookupResourceContext(ctx, resource, rels)
 }
 
 // LookupResource returns the JRD for the specified Resource.  If provided,
 // only the specified rel values will be requested, though WebFinger servers
 // are not obligated to respect that request.
 func (c *Client) LookupResource(resource *Resource, rels []string) (*JRD, error) {
-	c.logf("Looking up WebFinger data for %s", resource)
+	return c.LookupResourceContext(context.Background(), resource, rels)
+}
+
+// LookupResourceContext is like LookupResource, but the lookup is bound to
+// ctx.  If ctx is cancelled or its deadline expires before the lookup
+// completes, ctx.Err() is returned.
+func (c *Client) LookupResourceContext(ctx context.Context, resource *Resource, rels []string) (*JRD, error) {
+	return c.LookupResourceAtContext(ctx, resource, "", rels)
+}
+
+// LookupResourceAt returns the JRD for the specified Resource, querying the
+// WebFinger server at host rather than the one derived from the resource.
+// The resource itself is queried unchanged.  This is useful when WebFinger
+// is delegated to another host, or to query a staging or local server.  If
+// host is empty, it behaves like LookupResource.
+func (c *Client) LookupResourceAt(resource *Resource, host string, rels []string) (*JRD, error) {
+	return c.LookupResourceAtContext(context.Background(), resource, host, rels)
+}
+
+// LookupResourceAtContext is like LookupResourceAt, but the lookup is bound
+// to ctx.  If ctx is cancelled or its deadline expires before the lookup
+// completes, ctx.Err() is returned.
+func (c *Client) LookupResourceAtContext(ctx context.Context, resource *Resource, host string, rels []string) (*JRD, error) {
+	result, err := c.lookupResult(ctx, resource, host, rels, false)
+	if err != nil {
+		return nil, err
+	}
+	return result.jrd, nil
+}
+
+// LookupResourceFull is like LookupResource, but also returns the HTTP
+// response the JRD was read from, for access to its headers.  The response
+// body has already been read and closed.  If the JRD was served from the
+// client's Cache, the returned response is nil.
+func (c *Client) LookupResourceFull(resource *Resource, rels []string) (*JRD, *http.Response, error) {
+	return c.LookupResourceFullContext(context.Background(), resource, rels)
+}
+
+// LookupResourceFullContext is like LookupResourceFull, but the lookup is
+// bound to ctx.  If ctx is cancelled or its deadline expires before the
+// lookup completes, ctx.Err() is returned.
+func (c *Client) LookupResourceFullContext(ctx context.Context, resource *Resource, rels []string) (*JRD, *http.Response, error) {
+	result, err := c.lookupResult(ctx, resource, "", rels, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.jrd, result.res, nil
+}
+
+// LookupRaw is like Lookup, but also returns the response body the JRD was
+// parsed from, exactly as the server sent it, for callers that store, sign or
+// re-serve it.  The body has passed the client's content type and size
+// checks, and is not affected by FilterRels.  If the JRD was found using the
+// host-meta fallback, the body may be an XRD document.  If the JRD was merged
+// from several responses with QueryRelsSeparately, the body is nil.
+func (c *Client) LookupRaw(identifier string, rels []string) ([]byte, *JRD, error) {
+	return c.LookupRawContext(context.Background(), identifier, rels)
+}
+
+// LookupRawContext is like LookupRaw, but the lookup is bound to ctx.  If ctx
+// is cancelled or its deadline expires before the lookup completes, ctx.Err()
+// is returned.
+func (c *Client) LookupRawContext(ctx context.Context, identifier string, rels []string) ([]byte, *JRD, error) {
+	resource, err := Parse(identifier)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := c.lookupResult(ctx, resource, "", rels, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.body, result.jrd, nil
+}
+
+// LookupAccount returns the acct URI of the account identified by
+// identifier, typically the URL of a profile page such as
+// "https://example.com/@bob".  The identifier is looked up as a resource and
+// the acct URI is read from the subject or aliases of its JRD, as described
+// by JRD.AcctURI.
+func (c *Client) LookupAccount(identifier string) (string, error) {
+	return c.LookupAccountContext(context.Background(), identifier)
+}
+
+// LookupAccountContext is like LookupAccount, but the lookup is bound to ctx.
+// If ctx is cancelled or its deadline expires before the lookup completes,
+// ctx.Err() is returned.
+func (c *Client) LookupAccountContext(ctx context.Context, identifier string) (string, error) {
+	jrd, err := c.LookupContext(ctx, identifier, nil)
+	if err != nil {
+		return "", err
+	}
+	acct, ok := jrd.AcctURI()
+	if !ok {
+		return "", fmt.Errorf("no acct URI in JRD for %s", identifier)
+	}
+	return acct, nil
+}
+
+// lookupResult looks up resource at host, or at its WebFinger host if host is
+// empty, applying the client's timeout, subject verification and rel
+// filtering.
+func (c *Client) lookupResult(ctx context.Context, resource *Resource, host string, rels []string, raw bool) (*fetchResult, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
 
-	resourceJRD, err := c.fetchJRD(resource.JRDURL(rels))
+	result, err := c.lookup(ctx, resource, host, rels, raw)
 	if err != nil {
 		return nil, err
 	}
+	if c.QueryRelsSeparately {
+		if result, err = c.lookupMissingRels(ctx, resource, host, rels, result); err != nil {
+			return nil, err
+		}
+	}
+	jrd := result.jrd
+	if c.VerifySubject && !describes(jrd, resource) {
+		return nil, &SubjectMismatchError{Resource: resource.String(), Subject: jrd.Subject}
+	}
+	if c.FilterRels {
+		filtered := *result
+		filtered.jrd = jrd.SelectRels(rels)
+		result = &filtered
+	}
+	return result, nil
+}
+
+// lookupMissingRels looks up each of rels for which result has no links
+// separately, merging the results into result.  Failed queries are logged
+// and skipped.  If any results are merged, the merged result has no body.
+func (c *Client) lookupMissingRels(ctx context.Context, resource *Resource, host string, rels []string, result *fetchResult) (*fetchResult, error) {
+	rels = uniqueRels(rels)
+	if len(rels) < 2 {
+		return result, nil
+	}
+	var missing []string
+	for _, rel := range rels {
+		if result.jrd.GetLinkByRel(rel) == nil {
+			missing = append(missing, rel)
+		}
+	}
+
+	merged := *result
+	for _, rel := range missing {
+		c.debugf("Querying rel %s separately", rel)
+		partial, err := c.lookup(ctx, resource, host, []string{rel}, false)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			c.infof("Querying rel %s separately failed (%v)", rel, err)
+			continue
+		}
+		merged.jrd = merged.jrd.Merge(partial.jrd)
+		merged.body = nil
+	}
+	return &merged, nil
+}
+
+// describes reports whether the subject or one of the aliases of jrd is equal
+// to resource.
+func describes(jrd *JRD, resource *Resource) bool {
+	for _, id := range append([]string{jrd.Subject}, jrd.Aliases...) {
+		if r, err := Parse(id); err == nil && r.Equal(resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupAll looks up the JRDs for multiple identifiers concurrently, using at
+// most c.Concurrency concurrent lookups.  Successful lookups are returned in
+// the first map and failed lookups in the second, both keyed by identifier.
+// A failed lookup does not affect the others.
+func (c *Client) LookupAll(ctx context.Context, identifiers []string, rels []string) (map[string]*JRD, map[string]error) {
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
 
-	return resourceJRD, nil
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		jrds    = make(map[string]*JRD)
+		errs    = make(map[string]error)
+		pending = make(chan string)
+	)
+	for i := 0; i < concurrency && i < len(identifiers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for identifier := range pending {
+				jrd, err := c.LookupContext(ctx, identifier, rels)
+				mu.Lock()
+				if err != nil {
+					errs[identifier] = err
+				} else {
+					jrds[identifier] = jrd
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	seen := make(map[string]bool, len(identifiers))
+	for _, identifier := range identifiers {
+		if !seen[identifier] {
+			seen[identifier] = true
+			pending <- identifier
+		}
+	}
+	close(pending)
+	wg.Wait()
+
+	return jrds, errs
 }
 
-func (c *Client) fetchJRD(jrdURL *url.URL) (*JRD, error) {
-	// TODO verify signature if not https
-	// TODO extract http cache info
+// lookup looks up resource at host, or at its WebFinger host if host is empty.
+// If raw is set, the body of the response is kept in the result.
+func (c *Client) lookup(ctx context.Context, resource *Resource, host string, rels []string, raw bool) (*fetchResult, error) {
+	c.infof("Looking up WebFinger data for %s", resource)
+
+	if host == "" && c.UseSRV {
+		if hostname := resource.JRDURL(nil).Hostname(); hostname != "" {
+			host = c.srvHost(ctx, hostname)
+		}
+	}
+	jrdURL := c.jrdURL(resource, host, rels)
+	if jrdURL.Host == "" {
+		return nil, fmt.Errorf("cannot determine WebFinger host for %s", resource)
+	}
+	if err := c.checkHost(jrdURL); err != nil {
+		return nil, err
+	}
+	key := jrdURL.String()
+	var cached *CacheEntry
+	if c.Cache != nil {
+		if entry, ok := c.Cache.Get(key); ok {
+			if entry.Fresh(time.Now()) {
+				c.infof("Using cached JRD for %s", key)
+				if c.CacheMetrics != nil {
+					c.CacheMetrics.CacheHit()
+				}
+				return &fetchResult{jrd: entry.JRD.Clone(), body: entry.Body, source: SourceCache, url: jrdURL}, nil
+			}
+			cached = entry
+		}
+		if c.CacheMetrics != nil {
+			c.CacheMetrics.CacheMiss()
+		}
+	}
 
-	// Get follows up to 10 redirects
-	c.logf("GET %s", jrdURL.String())
-	res, err := c.client.Get(jrdURL.String())
+	result, err := c.fetchJRD(ctx, jrdURL, cached, raw)
+	if err != nil && c.transportMode() == HTTPSWithFallback && jrdURL.Scheme == "https" && isFallbackError(err) {
+		c.infof("HTTPS request failed (%v), falling back to HTTP", err)
+		httpURL := *jrdURL
+		httpURL.Scheme = "http"
+		result, err = c.fetchJRD(ctx, &httpURL, cached, raw)
+	}
 	if err != nil {
+		if c.AllowHostMeta && IsNotFound(err) {
+			c.infof("Falling back to host-meta for %s", resource)
+			return c.lookupHostMeta(ctx, resource, jrdURL.Host)
+		}
 		return nil, err
 	}
 
-	if !(200 <= res.StatusCode && res.StatusCode < 300) {
-		return nil, errors.New(res.Status)
+	if c.Cache != nil && result.store && (result.etag != "" || result.expires.After(time.Now())) {
+		c.Cache.Set(key, &CacheEntry{JRD: result.jrd.Clone(), Body: result.body, Expires: result.expires, ETag: result.etag})
+		if c.CacheMetrics != nil {
+			c.CacheMetrics.CacheStore()
+		}
+	}
+
+	return result, nil
+}
+
+// checkHost returns a *HostPolicyError if the client's HostPolicy denies
+// requests to the host of u.
+func (c *Client) checkHost(u *url.URL) error {
+	if c.HostPolicy == nil {
+		return nil
+	}
+	if err := c.HostPolicy(u.Hostname()); err != nil {
+		return &HostPolicyError{Host: u.Hostname(), Err: err}
+	}
+	return nil
+}
+
+// jrdURL returns the WebFinger query URL for resource, with the client's
+// overrides applied.  If host is non-empty, the query is sent to host as is.
+func (c *Client) jrdURL(resource *Resource, host string, rels []string) *url.URL {
+	u := resource.JRDURL(rels)
+	u.Scheme = c.scheme()
+	if host != "" {
+		u.Host = asciiHost(host)
+	} else if c.Port != 0 && u.Host != "" {
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(c.Port))
+	}
+	if c.WellKnownPath != "" {
+		u.Path = c.WellKnownPath
+	}
+	return u
+}
+
+// fetchResult is the outcome of a successful fetch.
+type fetchResult struct {
+	jrd *JRD
+
+	// res is the response the JRD was read from, with its body closed.  It is
+	// nil if the JRD was not fetched.
+	res *http.Response
+
+	// body is the response body the JRD was parsed from, if known.
+	body []byte
+
+	// expires is the end of the response's freshness lifetime, and store
+	// reports whether the response may be cached at all.
+	expires time.Time
+	store   bool
+
+	// etag is the entity tag of the response, if any.
+	etag string
+
+	// source is where the JRD was found, and url the URL it was found at,
+	// after any redirects.
+	source Source
+	url    *url.URL
+}
+
+// fetchJRD fetches the JRD at jrdURL.  If cached is non-nil and has an ETag,
+// the request is made conditional, and cached.JRD is returned if the server
+// reports it has not been modified.  Unless the response body is needed, as
+// described for needBody, the JRD is parsed as the body is read without
+// buffering it, and the result has no body.
+func (c *Client) fetchJRD(ctx context.Context, jrdURL *url.URL, cached *CacheEntry, raw bool) (*fetchResult, error) {
+	accept := c.Accept
+	if accept == "" {
+		accept = jrdMediaType
+	}
+	req, err := c.newRequest(ctx, jrdURL, accept)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && cached != nil && cached.ETag != "" {
+		res.Body.Close()
+		c.debugf("JRD for %s not modified", jrdURL)
+		result := &fetchResult{jrd: cached.JRD.Clone(), res: res, body: cached.Body, etag: cached.ETag, source: SourceCache, url: responseURL(res, jrdURL)}
+		if etag := res.Header.Get("ETag"); etag != "" {
+			result.etag = etag
+		}
+		result.expires, result.store = freshness(res.Header, cached.JRD, time.Now())
+		return result, nil
+	}
+
+	if err := checkStatus(res); err != nil {
+		return nil, err
+	}
+
+	if !c.IgnoreContentType {
+		if !c.acceptableContentType(responseMediaType(res)) {
+			res.Body.Close()
+			return nil, fmt.Errorf("%w %q from %s", ErrUnexpectedContentType, res.Header.Get("Content-Type"), jrdURL)
+		}
+	}
+
+	var (
+		jrd      *JRD
+		content  []byte
+		warnings []string
+	)
+	if c.needBody(res, raw) {
+		if content, err = c.readBody(req, res); err != nil {
+			return nil, err
+		}
+		if err := c.verifyResponse(res, content); err != nil {
+			return nil, err
+		}
+		decoded, err := c.decodeCharset(res, content)
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(decoded)) == 0 {
+			return nil, bodyError(ctx, fmt.Errorf("%w from %s", ErrEmptyResponse, jrdURL))
+		}
+		if jrd, warnings, err = parseJRD(decoded, false); err != nil {
+			return nil, bodyError(ctx, fmt.Errorf("parsing JRD from %s: %w", jrdURL, err))
+		}
+	} else if jrd, warnings, err = c.streamJRD(req, res); err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		c.infof("JRD from %s: %s", jrdURL, warning)
 	}
 
-	content, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
+	result := &fetchResult{jrd: jrd, res: res, body: content, etag: res.Header.Get("ETag"), source: SourceHTTP, url: responseURL(res, jrdURL)}
+	result.expires, result.store = freshness(res.Header, jrd, time.Now())
+	return result, nil
+}
+
+// responseURL returns the URL res was received from, after any redirects, or
+// u if that is not known.
+func responseURL(res *http.Response, u *url.URL) *url.URL {
+	if res.Request != nil && res.Request.URL != nil {
+		return res.Request.URL
+	}
+	return u
+}
+
+// newRequest returns a GET request for u bound to ctx, with the Accept header
+// set to accept.
+func (c *Client) newRequest(ctx context.Context, u *url.URL, accept string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Accept", accept)
+	userAgent := c.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	return req, nil
+}
+
+// do sends req, retrying according to the client's RetryPolicy.  Each attempt
+// is passed to the client's RequestModifier before it is sent.  If the
+// request's context is done before a response is received, the context's
+// error is returned.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		// Do follows up to 10 redirects
+		c.debugf("GET %s", req.URL)
+		attemptReq := req.Clone(ctx)
+		if c.RequestModifier != nil {
+			if err := c.RequestModifier(attemptReq); err != nil {
+				return nil, fmt.Errorf("modifying request for %s: %w", req.URL, err)
+			}
+		}
+		res, err := c.send(attemptReq)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		p := c.RetryPolicy
+		if p == nil || attempt >= p.MaxAttempts {
+			return res, err
+		}
+		if (err != nil && !transientError(err)) || (err == nil && !p.retryable(res.StatusCode)) {
+			return res, err
+		}
+
+		delay, ok := p.backoff(attempt, res, time.Now())
+		if !ok {
+			return res, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return res, err
+		}
+		if err != nil {
+			c.infof("GET %s failed (%v), retrying in %v", req.URL, err, delay)
+		} else {
+			c.infof("GET %s returned %s, retrying in %v", req.URL, res.Status, delay)
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// checkStatus returns a *StatusError, and closes the response body, if res
+// does not have a 2xx status code.
+func checkStatus(res *http.Response) error {
+	if !(200 <= res.StatusCode && res.StatusCode < 300) {
+		res.Body.Close()
+		err := &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+		if res.Request != nil {
+			err.URL = res.Request.URL.String()
+		}
+		return err
+	}
+	return nil
+}
+
+// responseMediaType returns the lowercased media type of res, without any
+// parameters such as charset.  If the Content-Type header is missing or
+// invalid, an empty string is returned.
+func responseMediaType(res *http.Response) string {
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// DefaultContentTypes are the media types accepted for JRD responses when
+// Client.AcceptableContentTypes is empty.
+var DefaultContentTypes = []string{jrdMediaType, "application/json"}
+
+// acceptableContentType reports whether mediaType, as returned by
+// responseMediaType, is acceptable for a JRD response.
+func (c *Client) acceptableContentType(mediaType string) bool {
+	if mediaType == "" {
+		return false
+	}
+	types := c.AcceptableContentTypes
+	if len(types) == 0 {
+		types = DefaultContentTypes
+	}
+	for _, t := range types {
+		if want, _, err := mime.ParseMediaType(t); err == nil && want == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// readBody reads and closes the body of res, which was received for req,
+// replacing it with http.NoBody.  Bodies with a gzip or deflate content
+// encoding are decoded.  If the request's context is done before the body is
+// read, the context's error is returned.  If the decoded body is larger than
+// the client's limit, a *ResponseTooLargeError is returned.
+func (c *Client) readBody(req *http.Request, res *http.Response) ([]byte, error) {
+	limit := c.maxResponseBytes()
+	defer func() {
+		res.Body.Close()
+		res.Body = http.NoBody
+	}()
+
+	body, err := decodeBody(res)
+	var content []byte
+	if err == nil {
+		if limit > 0 {
+			body = io.LimitReader(body, limit+1)
+		}
+		content, err = ioutil.ReadAll(body)
+	}
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("reading response from %s: %w", req.URL, err)
+	}
+	if limit > 0 && int64(len(content)) > limit {
+		return nil, &ResponseTooLargeError{URL: req.URL.String(), Limit: limit}
+	}
+	return content, nil
+}
+
+// bodyError returns the error of ctx if it is done, or err otherwise.  It is
+// used for errors found in a response body, since a body cut short when ctx
+// is cancelled may end in a clean EOF and so appear empty or truncated.
+func bodyError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// maxResponseBytes returns the maximum size of a response body that is read,
+// or a negative number if there is no limit.
+func (c *Client) maxResponseBytes() int64 {
+	if c.MaxResponseBytes == 0 {
+		return DefaultMaxResponseBytes
+	}
+	return c.MaxResponseBytes
+}
+
+// needBody reports whether the body of res must be read into memory before
+// the JRD in it is parsed: because raw is set or the client has a Cache, so
+// the body is kept; because it is passed to VerifyInsecureResponse; or
+// because it must be transcoded from another charset.
+func (c *Client) needBody(res *http.Response, raw bool) bool {
+	if raw || c.Cache != nil {
+		return true
+	}
+	if c.VerifyInsecureResponse != nil && res.TLS == nil {
+		return true
+	}
+	_, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return err == nil && !isUTF8(params["charset"])
+}
+
+// streamJRD parses the JRD in the body of res as it is read, rather than
+// reading the whole body first.  The body is subject to the same size limit
+// and checks as in readBody, and is closed on return.
+func (c *Client) streamJRD(req *http.Request, res *http.Response) (*JRD, []string, error) {
+	limit := c.maxResponseBytes()
+	defer func() {
+		res.Body.Close()
+		res.Body = http.NoBody
+	}()
+
+	body, err := decodeBody(res)
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, nil, ctxErr
+		}
+		return nil, nil, fmt.Errorf("reading response from %s: %w", req.URL, err)
+	}
+	if limit > 0 {
+		body = io.LimitReader(body, limit+1)
+	}
+	r := &bodyReader{r: body}
+	jrd, warnings, err := parseJRDReader(r)
+	if err != nil || !r.content {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, nil, ctxErr
+		}
+	}
+	switch {
+	case r.err != nil:
+		return nil, nil, fmt.Errorf("reading response from %s: %w", req.URL, r.err)
+	case limit > 0 && r.n > limit:
+		return nil, nil, &ResponseTooLargeError{URL: req.URL.String(), Limit: limit}
+	case !r.content:
+		return nil, nil, fmt.Errorf("%w from %s", ErrEmptyResponse, req.URL)
+	case err != nil:
+		return nil, nil, fmt.Errorf("parsing JRD from %s: %w", req.URL, err)
+	}
+	return jrd, warnings, nil
+}
 
-	return ParseJRD(content)
+// bodyReader wraps a response body that is parsed as it is read, recording
+// the number of bytes read, whether any of them were not whitespace, and any
+// read error other than io.EOF.
+type bodyReader struct {
+	r       io.Reader
+	n       int64
+	content bool
+	err     error
 }
 
-func (c *Client) logf(format string, v ...interface{}) {
-	if c.Logger != nil {
-		c.Logger.Printf(format, v...)
-	} else {
-		log.Printf(format, v...)
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if !b.content && len(bytes.TrimSpace(p[:n])) > 0 {
+		b.content = true
+	}
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// verifyResponse calls the client's VerifyInsecureResponse hook if res was
+// not received over HTTPS.  The hook is given a copy of res whose body reads
+// content.
+func (c *Client) verifyResponse(res *http.Response, content []byte) error {
+	if c.VerifyInsecureResponse == nil || res.TLS != nil {
+		return nil
+	}
+	verify := *res
+	verify.Body = ioutil.NopCloser(bytes.NewReader(content))
+	if err := c.VerifyInsecureResponse(&verify); err != nil {
+		return fmt.Errorf("verifying response from %s: %w", res.Request.URL, err)
+	}
+	return nil
+}
+
+// decodeCharset returns content, the body of res, transcoded to UTF-8 from
+// the charset named in its Content-Type.  If the client requires UTF-8, other
+// charsets are rejected with an error wrapping ErrUnsupportedCharset.
+func (c *Client) decodeCharset(res *http.Response, content []byte) ([]byte, error) {
+	_, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return content, nil
+	}
+	charset := strings.ToLower(params["charset"])
+	if isUTF8(charset) {
+		return content, nil
+	}
+	if c.RequireUTF8 {
+		return nil, fmt.Errorf("%w %q from %s", ErrUnsupportedCharset, charset, res.Request.URL)
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q from %s", ErrUnsupportedCharset, charset, res.Request.URL)
+	}
+	c.debugf("Decoding %s response from %s", charset, res.Request.URL)
+	decoded, err := enc.NewDecoder().Bytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s response from %s: %w", charset, res.Request.URL, err)
+	}
+	return decoded, nil
+}
+
+// isUTF8 reports whether charset, from a Content-Type header, is UTF-8 or a
+// subset of it, so that content in it needs no transcoding.
+func isUTF8(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return true
+	}
+	return false
+}
+
+// decodeBody returns a reader for the body of res with any gzip or deflate
+// content encoding removed.  The transport only does this itself when it
+// requested compression, so responses to requests with an explicit
+// Accept-Encoding header, or sent by a transport with compression disabled,
+// are decoded here.
+func decodeBody(res *http.Response) (io.Reader, error) {
+	if res.Uncompressed {
+		return res.Body, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(res.Body)
+	case "deflate":
+		return zlib.NewReader(res.Body)
 	}
+	return res.Body, nil
 }
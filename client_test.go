@@ -1,12 +1,23 @@
 package webfinger
 
 import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -34,6 +45,37 @@ func TestNewClient_EmptyClient(t *testing.T) {
 	}
 }
 
+// roundTripperFunc is an http.RoundTripper implemented by a function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewClientWithTransport(t *testing.T) {
+	var requests []string
+	client := NewClientWithTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req.URL.String())
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/jrd+json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"subject":"acct:bob@example.com"}`)),
+			Request:    req,
+		}, nil
+	}))
+
+	jrd, err := client.Lookup("acct:bob@example.com", nil)
+	if err != nil {
+		t.Fatalf("Lookup returned error: %v", err)
+	}
+	if want := (&JRD{Subject: "acct:bob@example.com"}); !cmp.Equal(jrd, want) {
+		t.Errorf("Lookup returned %#v, want %#v", jrd, want)
+	}
+	if want := []string{"https://example.com/.well-known/webfinger?resource=acct%3Abob%40example.com"}; !cmp.Equal(requests, want) {
+		t.Errorf("RoundTripper received requests %q, want %q", requests, want)
+	}
+}
+
 func TestResource_Parse(t *testing.T) {
 	tests := []struct {
 		input string
@@ -56,6 +98,45 @@ func TestResource_Parse(t *testing.T) {
 	}
 }
 
+func TestResource_Parse_roundTrip(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"juliet%40capulet.example@shoppingsite.example", "acct:juliet%40capulet.example@shoppingsite.example"},
+		{"juliet@capulet.example@shoppingsite.example", "acct:juliet%40capulet.example@shoppingsite.example"},
+		{"acct:juliet%40capulet.example@shoppingsite.example", "acct:juliet%40capulet.example@shoppingsite.example"},
+		{"acct:juliet@capulet.example@shoppingsite.example", "acct:juliet%40capulet.example@shoppingsite.example"},
+		{"acct:Juliet%2540x@example.com", "acct:Juliet%2540x@example.com"},
+		{"bob smith@example.com", "acct:bob%20smith@example.com"},
+		{"acct:bob+tag@example.com", "acct:bob+tag@example.com"},
+		{"acct:bob@example.com", "acct:bob@example.com"},
+		{"mailto:a%40b@example.com", "mailto:a%40b@example.com"},
+	}
+
+	for _, tt := range tests {
+		r, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+		}
+		got := r.String()
+		if got != tt.want {
+			t.Errorf("Parse(%q).String() returned %q, want %q", tt.input, got, tt.want)
+		}
+
+		r2, err := Parse(got)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", got, err)
+		}
+		if !cmp.Equal(r2, r) {
+			t.Errorf("Parse(%q) returned %#v, want %#v", got, r2, r)
+		}
+		if got, want := r2.JRDURL(nil).Query().Get("resource"), tt.want; got != want {
+			t.Errorf("JRDURL() for %q has resource %q, want %q", tt.input, got, want)
+		}
+	}
+}
+
 func TestResource_Parse_error(t *testing.T) {
 	_, err := Parse("example.com")
 	if err == nil {
@@ -68,6 +149,37 @@ func TestResource_Parse_error(t *testing.T) {
 	}
 }
 
+func TestResource_ParseStrict(t *testing.T) {
+	for _, input := range []string{
+		"bob@example.com",
+		"acct:bob@example.com",
+		"mailto:bob@example.com",
+		"https://example.com/bob",
+		"HTTP://example.com/bob",
+		"tel:+1-816-555-1212",
+	} {
+		if _, err := ParseStrict(input); err != nil {
+			t.Errorf("ParseStrict(%q) returned error: %v", input, err)
+		}
+	}
+
+	for _, input := range []string{"javascript:alert(1)", "file:///etc/passwd", "data:text/plain,bob"} {
+		if _, err := ParseStrict(input); !errors.Is(err, ErrUnsupportedScheme) {
+			t.Errorf("ParseStrict(%q) returned %v, want ErrUnsupportedScheme", input, err)
+		}
+	}
+
+	if _, err := ParseStrict("https://example.com/bob", "acct"); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("ParseStrict with acct only returned %v, want ErrUnsupportedScheme", err)
+	}
+	if _, err := ParseStrict("bob@example.com", "acct"); err != nil {
+		t.Errorf("ParseStrict with acct only returned error: %v", err)
+	}
+	if _, err := ParseStrict("%"); err == nil || errors.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("ParseStrict(%q) returned %v, want parse error", "%", err)
+	}
+}
+
 func TestResource_WebFingerHost(t *testing.T) {
 	tests := []struct {
 		input string
@@ -84,6 +196,35 @@ func TestResource_WebFingerHost(t *testing.T) {
 		// Email style local account
 		{"acct:juliet%40capulet.example@shoppingsite.example", "shoppingsite.example"},
 		{"acct:juliet@capulet.example@shoppingsite.example", "shoppingsite.example"},
+		// tel URLs
+		{"tel:+1-816-555-1212", ""},
+		{"tel:7042;phone-context=Example.com", "example.com"},
+		{"tel:863-1234;phone-context=+1-914-555", ""},
+		// mixed-case hosts
+		{"acct:Bob@Example.COM", "example.com"},
+		// explicit ports
+		{"acct:bob@example.com:8443", "example.com:8443"},
+		{"acct:bob@Example.com:8443", "example.com:8443"},
+		{"mailto:bob@example.com:8443", "example.com:8443"},
+		{"acct:bob@[::1]:8443", "[::1]:8443"},
+		{"acct:bob@[::1]", "[::1]"},
+		{"acct:bob@example.com:", ""},
+		{"acct:bob@example.com:https", ""},
+		{"acct:bob@example.com:65536", ""},
+		{"acct:bob@example.com:0", ""},
+		{"acct:bob@:8443", ""},
+		{"HTTP://Example.com/Bob", "example.com"},
+		// fully-qualified domain names
+		{"bob@example.com.", "example.com"},
+		{"acct:bob@Example.com.:8443", "example.com:8443"},
+		{"https://example.com./bob", "example.com"},
+		{"tel:7042;phone-context=example.com.", "example.com"},
+		{"acct:bob@.", ""},
+		// other schemes, with and without an authority
+		{"myscheme://Example.com/bob", "example.com"},
+		{"myscheme://bob@example.com:8443/path", "example.com:8443"},
+		{"myscheme:bob", ""},
+		{"urn:example:bob", ""},
 	}
 
 	for _, tt := range tests {
@@ -95,6 +236,208 @@ func TestResource_WebFingerHost(t *testing.T) {
 	}
 }
 
+func TestResource_WebFingerHost_opaqueAuthority(t *testing.T) {
+	tests := []struct {
+		opaque string
+		want   string
+	}{
+		{"//Example.com/bob", "example.com"},
+		{"//bob@example.com:8443", "example.com:8443"},
+		{"//example.com:bogus/bob", ""},
+		{"///bob", ""},
+		{"bob/example.com", ""},
+	}
+
+	for _, tt := range tests {
+		r := &Resource{Scheme: "myscheme", Opaque: tt.opaque}
+		if got := r.WebFingerHost(); got != tt.want {
+			t.Errorf("WebFingerHost() with opaque %q returned %q, want %q", tt.opaque, got, tt.want)
+		}
+	}
+}
+
+func TestResource_Account(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantUser string
+		wantHost string
+		wantOK   bool
+	}{
+		{"bob@example.com", "bob", "example.com", true},
+		{"acct:bob@example.com", "bob", "example.com", true},
+		{"acct:juliet%40capulet.example@shoppingsite.example", "juliet@capulet.example", "shoppingsite.example", true},
+		{"acct:juliet@capulet.example@shoppingsite.example", "juliet@capulet.example", "shoppingsite.example", true},
+		{"acct:bob", "", "", false},
+		{"acct:@example.com", "", "", false},
+		{"acct:bob@", "", "", false},
+		{"acct:bob%zz@example.com", "", "", false},
+		{"mailto:bob@example.com", "", "", false},
+		{"https://example.com/bob", "", "", false},
+	}
+
+	for _, tt := range tests {
+		r, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+		}
+		user, host, ok := r.Account()
+		if user != tt.wantUser || host != tt.wantHost || ok != tt.wantOK {
+			t.Errorf("Account() for %q returned %q, %q, %v, want %q, %q, %v", tt.input, user, host, ok, tt.wantUser, tt.wantHost, tt.wantOK)
+		}
+	}
+
+	// schemes are case-insensitive, as for Kind
+	r := Resource(url.URL{Scheme: "ACCT", Opaque: "bob@example.com"})
+	if user, host, ok := r.Account(); user != "bob" || host != "example.com" || !ok {
+		t.Errorf("Account() for ACCT scheme returned %q, %q, %v, want %q, %q, true", user, host, ok, "bob", "example.com")
+	}
+}
+
+func TestResource_Kind(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Kind
+	}{
+		{"bob@example.com", KindAccount},
+		{"acct:bob@example.com", KindAccount},
+		{"http://example.com/bob", KindHTTPURL},
+		{"https://example.com/bob", KindHTTPURL},
+		{"HTTPS://example.com/bob", KindHTTPURL},
+		{"mailto:bob@example.com", KindMailto},
+		{"file:///home/bob", KindOther},
+		{"tel:+1-816-555-1212", KindOther},
+	}
+
+	for _, tt := range tests {
+		r, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+		}
+		if got := r.Kind(); got != tt.want {
+			t.Errorf("Kind() for %q returned %v, want %v", tt.input, got, tt.want)
+		}
+	}
+
+	if got, want := Kind(42).String(), "Kind(42)"; got != want {
+		t.Errorf("Kind(42).String() returned %q, want %q", got, want)
+	}
+}
+
+func TestResource_MarshalText(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"bob@example.com", `{"resource":"acct:bob@example.com"}`},
+		{"https://example.com/bob", `{"resource":"https://example.com/bob"}`},
+	}
+
+	type config struct {
+		Resource *Resource `json:"resource"`
+	}
+	for _, tt := range tests {
+		var c config
+		if err := json.Unmarshal([]byte(`{"resource":"`+tt.input+`"}`), &c); err != nil {
+			t.Fatalf("Unmarshal(%q) returned error: %v", tt.input, err)
+		}
+		want, _ := Parse(tt.input)
+		if !cmp.Equal(c.Resource, want) {
+			t.Errorf("Unmarshal(%q) returned %#v, want %#v", tt.input, c.Resource, want)
+		}
+
+		got, err := json.Marshal(c)
+		if err != nil {
+			t.Fatalf("Marshal returned error: %v", err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal(%q) returned %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	var r Resource
+	if err := r.UnmarshalText([]byte("example.com")); err == nil {
+		t.Error("UnmarshalText of invalid resource did not return expected error")
+	}
+}
+
+func TestResource_Normalize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"acct:bob@example.com", "acct:bob@example.com"},
+		{"acct:Bob@Example.COM", "acct:Bob@example.com"},
+		{"ACCT:Bob@Example.COM", "acct:Bob@example.com"},
+		{"Bob@Example.COM", "acct:Bob@example.com"},
+		{"mailto:Bob.Smith@Example.COM", "mailto:Bob.Smith@example.com"},
+		{"acct:Juliet%40Capulet.example@Shoppingsite.Example", "acct:Juliet%40Capulet.example@shoppingsite.example"},
+		{"HTTPS://Example.COM/Bob", "https://example.com/Bob"},
+	}
+
+	for _, tt := range tests {
+		r, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+		}
+		if got := r.Normalize().String(); got != tt.want {
+			t.Errorf("Parse(%q).Normalize() returned %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	r, _ := Parse("acct:Bob@Example.COM")
+	r.Normalize()
+	if got, want := r.String(), "acct:Bob@Example.COM"; got != want {
+		t.Errorf("Normalize() modified its receiver to %q, want %q", got, want)
+	}
+
+	a, _ := Parse("acct:bob@Example.COM")
+	b, _ := Parse("acct:bob@example.com")
+	if got, want := a.Normalize().JRDURL(nil), b.JRDURL(nil); !cmp.Equal(got, want) {
+		t.Errorf("Normalized JRDURL() returned %v, want %v", got, want)
+	}
+}
+
+func TestResource_Equal(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"acct:bob@example.com", "bob@example.com", true},
+		{"acct:bob@example.com", "ACCT:bob@Example.COM", true},
+		{"acct:bob@example.com", "acct:%62ob@example.com", true},
+		{"acct:juliet%40capulet.example@shoppingsite.example", "acct:juliet@capulet.example@shoppingsite.example", true},
+		{"acct:juliet%40capulet.example@shoppingsite.example", "acct:juliet%40Capulet.example@shoppingsite.example", false},
+		{"acct:bob%2fsmith@example.com", "acct:bob%2Fsmith@example.com", true},
+		{"https://Example.com/%7Ebob", "https://example.com/~bob", true},
+		{"https://example.com/Bob", "https://example.com/bob", false},
+		{"acct:Bob@example.com", "acct:bob@example.com", false},
+		{"acct:bob@example.com", "mailto:bob@example.com", false},
+	}
+
+	for _, tt := range tests {
+		a, err := Parse(tt.a)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.a, err)
+		}
+		b, err := Parse(tt.b)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.b, err)
+		}
+		if got := a.Equal(b); got != tt.want {
+			t.Errorf("Equal(%q, %q) returned %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.Equal(a); got != tt.want {
+			t.Errorf("Equal(%q, %q) returned %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+
+	var nilResource *Resource
+	r, _ := Parse("acct:bob@example.com")
+	if r.Equal(nil) || !nilResource.Equal(nil) {
+		t.Error("Equal with nil resources returned unexpected result")
+	}
+}
+
 func TestResource_JRDURL(t *testing.T) {
 	r, _ := Parse("bob@example.com")
 	got := r.JRDURL([]string{"a", "b"})
@@ -105,6 +448,57 @@ func TestResource_JRDURL(t *testing.T) {
 	}
 }
 
+func TestResource_JRDURL_rels(t *testing.T) {
+	r, _ := Parse("bob@example.com")
+	got := r.JRDURL([]string{"self", "http://webfinger.net/rel/avatar", "self", "alternate", "http://webfinger.net/rel/avatar"})
+	// parameter names are sorted, but rels keep the caller's order
+	want := "rel=self&rel=http%3A%2F%2Fwebfinger.net%2Frel%2Favatar&rel=alternate&resource=acct%3Abob%40example.com"
+	if got.RawQuery != want {
+		t.Errorf("JRDURL() has query %q, want %q", got.RawQuery, want)
+	}
+
+	if got := r.JRDURL(nil).RawQuery; got != "resource=acct%3Abob%40example.com" {
+		t.Errorf("JRDURL(nil) has query %q, want no rel parameters", got)
+	}
+}
+
+func TestResource_JRDURL_idn(t *testing.T) {
+	tests := []struct {
+		input        string
+		wantHost     string
+		wantResource string
+	}{
+		{"bob@bücher.example", "xn--bcher-kva.example", "acct:bob@bücher.example"},
+		{"https://bücher.example:8443/bob", "xn--bcher-kva.example:8443", "https://b%C3%BCcher.example:8443/bob"},
+		{"bob@example.com", "example.com", "acct:bob@example.com"},
+	}
+
+	for _, tt := range tests {
+		r, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+		}
+		got := r.JRDURL(nil)
+		if got.Host != tt.wantHost {
+			t.Errorf("JRDURL() for %q has host %q, want %q", tt.input, got.Host, tt.wantHost)
+		}
+		if resource := got.Query().Get("resource"); resource != tt.wantResource {
+			t.Errorf("JRDURL() for %q has resource %q, want %q", tt.input, resource, tt.wantResource)
+		}
+	}
+}
+
+func TestResource_JRDURL_trailingDot(t *testing.T) {
+	r, _ := Parse("bob@example.com.")
+	got := r.JRDURL(nil)
+	if want := "example.com"; got.Host != want {
+		t.Errorf("JRDURL() has host %q, want %q", got.Host, want)
+	}
+	if resource, want := got.Query().Get("resource"), "acct:bob@example.com."; resource != want {
+		t.Errorf("JRDURL() has resource %q, want %q", resource, want)
+	}
+}
+
 func TestResource_String(t *testing.T) {
 	r, _ := Parse("bob@example.com")
 	if got, want := r.String(), "acct:bob@example.com"; got != want {
@@ -135,20 +529,1040 @@ func TestLookup(t *testing.T) {
 	}
 }
 
-func TestLookup_parseError(t *testing.T) {
-	// use default client here, just to make sure that gets tested
-	_, err := Lookup("bob", nil)
-	if err == nil {
-		t.Error("Expected parse error")
+func TestLookup_timeout(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.Timeout = 50 * time.Millisecond
+
+	done := make(chan struct{})
+	defer close(done)
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		// send headers and part of the body, then stall
+		w.Header().Add("content-type", "application/jrd+json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"subject":`)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+
+	// Lookup parses the body as it is read, and LookupRaw reads it first
+	lookups := map[string]func(ctx context.Context) error{
+		"Lookup": func(ctx context.Context) error {
+			_, err := client.LookupContext(ctx, "acct:bob@"+host, nil)
+			return err
+		},
+		"LookupRaw": func(ctx context.Context) error {
+			_, _, err := client.LookupRawContext(ctx, "acct:bob@"+host, nil)
+			return err
+		},
+	}
+	for name, lookup := range lookups {
+		client.Timeout = 50 * time.Millisecond
+		start := time.Now()
+		if err := lookup(context.Background()); err != context.DeadlineExceeded {
+			t.Errorf("%s returned error %v, want %v", name, err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s took %v to time out", name, elapsed)
+		}
+
+		// an earlier context deadline takes precedence
+		client.Timeout = time.Hour
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if err := lookup(ctx); err != context.DeadlineExceeded {
+			t.Errorf("%s with context deadline returned error %v, want %v", name, err, context.DeadlineExceeded)
+		}
+		cancel()
 	}
 }
 
-func TestLookup_404(t *testing.T) {
-	client, _, host, teardown := setup()
+func TestLookup_accept(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/jrd+json"},
+		{"application/jrd+json, application/json;q=0.9", "application/jrd+json, application/json;q=0.9"},
+	}
+
+	for _, tt := range tests {
+		client, mux, host, teardown := setup()
+		client.Accept = tt.accept
+
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("Accept"); got != tt.want {
+				t.Errorf("Request Accept header is %q, want %q", got, tt.want)
+			}
+			w.Header().Add("content-type", "application/jrd+json")
+			fmt.Fprint(w, `{}`)
+		})
+
+		if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+			t.Errorf("Unexpected error lookup up webfinger: %v", err)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_userAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"", "go-webfinger/" + Version},
+		{"my-app/1.0", "my-app/1.0"},
+	}
+
+	for _, tt := range tests {
+		client, mux, host, teardown := setup()
+		client.UserAgent = tt.userAgent
+
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("User-Agent"); got != tt.want {
+				t.Errorf("Request User-Agent header is %q, want %q", got, tt.want)
+			}
+			w.Header().Add("content-type", "application/jrd+json")
+			fmt.Fprint(w, `{}`)
+		})
+
+		if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+			t.Errorf("Unexpected error lookup up webfinger: %v", err)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_contentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		ignore      bool
+		wantErr     bool
+	}{
+		{"application/jrd+json", false, false},
+		{"application/json", false, false},
+		{"application/jrd+json; charset=utf-8", false, false},
+		{"application/json;charset=UTF-8", false, false},
+		{"Application/JRD+JSON", false, false},
+		{"text/html", false, true},
+		{"application/jrd+json; charset", false, true},
+		{"", false, true},
+		{"text/html", true, false},
+	}
+
+	for _, tt := range tests {
+		client, mux, host, teardown := setup()
+		client.IgnoreContentType = tt.ignore
+
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			w.Header()["Content-Type"] = []string{tt.contentType}
+			fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+		})
+
+		_, err := client.Lookup("acct:bob@"+host, nil)
+		if tt.wantErr {
+			if !errors.Is(err, ErrUnexpectedContentType) {
+				t.Errorf("Lookup with content type %q returned %v, want ErrUnexpectedContentType", tt.contentType, err)
+			}
+		} else if err != nil {
+			t.Errorf("Lookup with content type %q returned unexpected error: %v", tt.contentType, err)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_acceptableContentTypes(t *testing.T) {
+	tests := []struct {
+		contentType string
+		wantErr     bool
+	}{
+		{"application/ld+json", false},
+		{`application/ld+json; profile="https://www.w3.org/ns/activitystreams"`, false},
+		{"Application/JRD+JSON", false},
+		{"application/json", true},
+		{"text/html", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		client, mux, host, teardown := setup()
+		client.AcceptableContentTypes = []string{"application/jrd+json", "Application/LD+JSON"}
+
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			w.Header()["Content-Type"] = []string{tt.contentType}
+			fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+		})
+
+		_, err := client.Lookup("acct:bob@"+host, nil)
+		if tt.wantErr {
+			if !errors.Is(err, ErrUnexpectedContentType) {
+				t.Errorf("Lookup with content type %q returned %v, want ErrUnexpectedContentType", tt.contentType, err)
+			}
+		} else if err != nil {
+			t.Errorf("Lookup with content type %q returned unexpected error: %v", tt.contentType, err)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_emptyResponse(t *testing.T) {
+	for _, body := range []string{"", " \r\n\t"} {
+		client, mux, host, teardown := setup()
+
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("content-type", "application/jrd+json")
+			fmt.Fprint(w, body)
+		})
+
+		_, err := client.Lookup("acct:bob@"+host, nil)
+		if !errors.Is(err, ErrEmptyResponse) {
+			t.Errorf("Lookup with body %q returned %v, want ErrEmptyResponse", body, err)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_streamed(t *testing.T) {
+	client, mux, host, teardown := setup()
 	defer teardown()
+	client.MaxResponseBytes = 256
 
-	_, err := client.Lookup("bob@"+host, nil)
-	if err == nil {
-		t.Error("Expected error")
+	tests := map[string]struct {
+		body string
+		want string
+	}{
+		"valid":     {`{"subject":"acct:bob@example.com","expires":"tomorrow","links":[{"rel":"self","href":"https://example.com/bob"}]}`, "nil"},
+		"empty":     {" \r\n", "empty"},
+		"large":     {`{"subject":"acct:bob@example.com","aliases":["` + strings.Repeat("a", 256) + `"]}`, "too large"},
+		"trailing":  {`{"subject":"acct:bob@example.com"} {}`, "other"},
+		"wrongtype": {`{"subject":42}`, "other"},
+	}
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.SplitN(strings.TrimPrefix(r.FormValue("resource"), "acct:"), "@", 2)[0]
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, tests[name].body)
+	})
+
+	kind := func(err error) string {
+		var tooLarge *ResponseTooLargeError
+		switch {
+		case err == nil:
+			return "nil"
+		case errors.Is(err, ErrEmptyResponse):
+			return "empty"
+		case errors.As(err, &tooLarge):
+			return "too large"
+		}
+		return "other"
+	}
+
+	// Lookup parses the body as it is read; LookupRaw reads it first
+	for name, tt := range tests {
+		resource := "acct:" + name + "@" + host
+		streamed, streamErr := client.Lookup(resource, nil)
+		_, buffered, bufferErr := client.LookupRaw(resource, nil)
+		if got := kind(streamErr); got != tt.want {
+			t.Errorf("%s: Lookup returned error %v, want %s", name, streamErr, tt.want)
+		}
+		if got := kind(bufferErr); got != tt.want {
+			t.Errorf("%s: LookupRaw returned error %v, want %s", name, bufferErr, tt.want)
+		}
+		if !cmp.Equal(streamed, buffered) {
+			t.Errorf("%s: Lookup returned %#v, LookupRaw returned %#v", name, streamed, buffered)
+		}
+	}
+}
+
+func TestLookup_contentEncoding(t *testing.T) {
+	const body = `{"subject":"bob@example.com"}`
+	tests := []struct {
+		encoding string
+		compress func(io.Writer) io.WriteCloser
+	}{
+		{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{"deflate", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+	}
+
+	for _, tt := range tests {
+		client, mux, host, teardown := setup()
+		// the transport would otherwise decode gzip responses itself
+		client.client.Transport.(*http.Transport).DisableCompression = true
+
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("content-type", "application/jrd+json")
+			w.Header().Set("Content-Encoding", tt.encoding)
+			zw := tt.compress(w)
+			fmt.Fprint(zw, body)
+			zw.Close()
+		})
+
+		jrd, err := client.Lookup("acct:bob@"+host, nil)
+		if err != nil {
+			t.Errorf("Lookup with %s encoding returned error: %v", tt.encoding, err)
+		} else if want := (&JRD{Subject: "bob@example.com"}); !cmp.Equal(jrd, want) {
+			t.Errorf("Lookup with %s encoding returned %#v, want %#v", tt.encoding, jrd, want)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_requestModifier(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.RequestModifier = func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer s3cret")
+		return nil
+	}
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("Authorization"), "Bearer s3cret"; got != want {
+			t.Errorf("Authorization header is %q, want %q", got, want)
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Errorf("Unexpected error lookup up webfinger: %v", err)
+	}
+
+	errNoToken := errors.New("no token")
+	client.RequestModifier = func(req *http.Request) error { return errNoToken }
+	if _, err := client.Lookup("acct:bob@"+host, nil); !errors.Is(err, errNoToken) {
+		t.Errorf("Lookup with failing RequestModifier returned %v, want %v", err, errNoToken)
+	}
+}
+
+func TestClient_PlanLookup(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.WellKnownPath = "/wf"
+	rels := []string{"self", "http://webfinger.net/rel/avatar"}
+
+	var requested string
+	mux.HandleFunc("/wf", func(w http.ResponseWriter, r *http.Request) {
+		requested = "https://" + host + r.URL.RequestURI()
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	planned, err := client.PlanLookup("acct:bob@"+host, rels)
+	if err != nil {
+		t.Fatalf("PlanLookup returned error: %v", err)
+	}
+	if _, err := client.Lookup("acct:bob@"+host, rels); err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if planned.String() != requested {
+		t.Errorf("PlanLookup returned %q, but Lookup requested %q", planned, requested)
+	}
+
+	client.Port = 8443
+	planned, err = client.PlanLookup("bob@bücher.example", nil)
+	if err != nil {
+		t.Fatalf("PlanLookup returned error: %v", err)
+	}
+	if got, want := planned.String(), "https://xn--bcher-kva.example:8443/wf?resource=acct%3Abob%40b%C3%BCcher.example"; got != want {
+		t.Errorf("PlanLookup returned %q, want %q", got, want)
+	}
+
+	if _, err := client.PlanLookup("tel:+1-816-555-1212", nil); err == nil {
+		t.Error("PlanLookup for resource without host did not return expected error")
+	}
+	if _, err := client.PlanLookup("example.com", nil); err == nil {
+		t.Error("PlanLookup for invalid identifier did not return expected error")
+	}
+}
+
+func TestLookup_charset(t *testing.T) {
+	// "Zoë" in ISO-8859-1
+	body := []byte("{\"subject\":\"acct:zo\xeb@example.com\"}")
+
+	tests := []struct {
+		contentType string
+		requireUTF8 bool
+		want        string
+		wantErr     bool
+	}{
+		{"application/jrd+json; charset=ISO-8859-1", false, "acct:zoë@example.com", false},
+		{"application/jrd+json; charset=windows-1252", false, "acct:zoë@example.com", false},
+		{"application/jrd+json; charset=ISO-8859-1", true, "", true},
+		{"application/jrd+json; charset=x-unknown", false, "", true},
+	}
+
+	for _, tt := range tests {
+		client, mux, host, teardown := setup()
+		client.RequireUTF8 = tt.requireUTF8
+
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			w.Write(body)
+		})
+
+		jrd, err := client.Lookup("acct:bob@"+host, nil)
+		if tt.wantErr {
+			if !errors.Is(err, ErrUnsupportedCharset) {
+				t.Errorf("Lookup with %q and RequireUTF8 %v returned %v, want ErrUnsupportedCharset", tt.contentType, tt.requireUTF8, err)
+			}
+		} else if err != nil {
+			t.Errorf("Lookup with %q returned unexpected error: %v", tt.contentType, err)
+		} else if jrd.Subject != tt.want {
+			t.Errorf("Lookup with %q returned subject %q, want %q", tt.contentType, jrd.Subject, tt.want)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_hostPolicy(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	errDenied := errors.New("internal host")
+	var checked []string
+	client.HostPolicy = func(host string) error {
+		checked = append(checked, host)
+		if host == "localhost" || host == "169.254.169.254" {
+			return errDenied
+		}
+		return nil
+	}
+
+	requests := 0
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	// allowed host
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Errorf("Lookup of allowed host returned unexpected error: %v", err)
+	}
+	hostname, _, _ := net.SplitHostPort(host)
+	if want := []string{hostname}; !cmp.Equal(checked, want) {
+		t.Errorf("HostPolicy called with %q, want %q", checked, want)
+	}
+
+	// denied hosts
+	for _, resource := range []string{"acct:bob@169.254.169.254", "https://localhost:8443/bob"} {
+		_, err := client.Lookup(resource, nil)
+		var policyErr *HostPolicyError
+		if !errors.As(err, &policyErr) || !errors.Is(err, errDenied) {
+			t.Errorf("Lookup(%q) returned %v, want *HostPolicyError", resource, err)
+		}
+	}
+
+	// explicit host
+	r, _ := Parse("acct:bob@example.com")
+	if _, err := client.LookupResourceAt(r, "169.254.169.254:443", nil); !errors.Is(err, errDenied) {
+		t.Errorf("LookupResourceAt denied host returned %v, want HostPolicy error", err)
+	}
+
+	if requests != 1 {
+		t.Errorf("Server received %d requests, want 1", requests)
+	}
+}
+
+func TestLookup_hostPolicyLRDD(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.AllowHostMeta = true
+
+	errDenied := errors.New("internal host")
+	client.HostPolicy = func(host string) error {
+		if host == "169.254.169.254" {
+			return errDenied
+		}
+		return nil
+	}
+
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/xrd+xml")
+		fmt.Fprint(w, `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+			  <Link rel='lrdd' template='https://169.254.169.254/latest/meta-data?uri={uri}' />
+			</XRD>`)
+	})
+
+	_, err := client.Lookup("acct:bob@"+host, nil)
+	var policyErr *HostPolicyError
+	if !errors.As(err, &policyErr) || policyErr.Host != "169.254.169.254" {
+		t.Errorf("Lookup with denied lrdd host returned %v, want *HostPolicyError", err)
+	}
+}
+
+func TestLookupAccount(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	profile := "https://" + host + "/@bob"
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		switch r.FormValue("resource") {
+		case profile:
+			fmt.Fprintf(w, `{"subject":"acct:bob@example.com","aliases":[%q]}`, profile)
+		default:
+			fmt.Fprint(w, `{"subject":"https://example.com/about"}`)
+		}
+	})
+
+	got, err := client.LookupAccount(profile)
+	if err != nil {
+		t.Fatalf("LookupAccount returned error: %v", err)
+	}
+	if want := "acct:bob@example.com"; got != want {
+		t.Errorf("LookupAccount(%q) returned %q, want %q", profile, got, want)
+	}
+
+	if _, err := client.LookupAccount("https://" + host + "/about"); err == nil {
+		t.Error("LookupAccount for JRD without acct URI did not return expected error")
+	}
+}
+
+func TestLookup_queryRelsSeparately(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	links := map[string]string{
+		"self":                            `{"rel":"self","href":"https://example.com/users/bob"}`,
+		"http://webfinger.net/rel/avatar": `{"rel":"http://webfinger.net/rel/avatar","href":"https://example.com/bob.png"}`,
+		"alternate":                       `{"rel":"alternate","href":"https://example.com/@bob"}`,
+	}
+	var queries [][]string
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		// only honour the first rel
+		rels := r.URL.Query()["rel"]
+		queries = append(queries, rels)
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{"subject":"acct:bob@example.com","links":[%s]}`, links[rels[0]])
+	})
+
+	rels := []string{"self", "http://webfinger.net/rel/avatar", "alternate"}
+	jrd, err := client.Lookup("acct:bob@"+host, rels)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if got := len(jrd.Links); got != 1 || len(queries) != 1 {
+		t.Errorf("Lookup without QueryRelsSeparately returned %d links with %d queries, want 1 and 1", got, len(queries))
+	}
+
+	client.QueryRelsSeparately = true
+	queries = nil
+	jrd, err = client.Lookup("acct:bob@"+host, rels)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	var got []string
+	for _, link := range jrd.Links {
+		got = append(got, link.Rel)
+	}
+	if !cmp.Equal(got, rels) {
+		t.Errorf("Lookup with QueryRelsSeparately returned links for %q, want %q", got, rels)
+	}
+	wantQueries := [][]string{rels, {"http://webfinger.net/rel/avatar"}, {"alternate"}}
+	if !cmp.Equal(queries, wantQueries) {
+		t.Errorf("Server received queries for rels %q, want %q", queries, wantQueries)
+	}
+}
+
+func TestLookup_queryRelsSeparatelyFailure(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.QueryRelsSeparately = true
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		rels := r.URL.Query()["rel"]
+		if len(rels) == 1 && rels[0] == "alternate" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		if len(rels) == 1 {
+			fmt.Fprint(w, `{"subject":"acct:bob@example.com","links":[{"rel":"http://webfinger.net/rel/avatar","href":"https://example.com/bob.png"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"subject":"acct:bob@example.com","links":[{"rel":"self","href":"https://example.com/users/bob"}]}`)
+	})
+
+	rels := []string{"self", "http://webfinger.net/rel/avatar", "alternate"}
+	body, jrd, err := client.LookupRaw("acct:bob@"+host, rels)
+	if err != nil {
+		t.Fatalf("LookupRaw with failed rel query returned error: %v", err)
+	}
+	var got []string
+	for _, link := range jrd.Links {
+		got = append(got, link.Rel)
+	}
+	if want := rels[:2]; !cmp.Equal(got, want) {
+		t.Errorf("LookupRaw returned links for %q, want %q", got, want)
+	}
+	if body != nil {
+		t.Errorf("LookupRaw returned body %q for merged JRD, want nil", body)
+	}
+}
+
+func TestLookup_filterRels(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.FilterRels = true
+
+	// server ignores the rel parameter
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com","links":[
+			{"rel":"a","href":"https://example.com/a1"},
+			{"rel":"b","href":"https://example.com/b"},
+			{"rel":"c","href":"https://example.com/c"},
+			{"rel":"a","href":"https://example.com/a2"}]}`)
+	})
+
+	jrd, err := client.Lookup("acct:bob@"+host, []string{"c", "a"})
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	want := &JRD{
+		Subject: "bob@example.com",
+		Links: []Link{
+			{Rel: "a", Href: "https://example.com/a1"},
+			{Rel: "c", Href: "https://example.com/c"},
+			{Rel: "a", Href: "https://example.com/a2"},
+		},
+	}
+	if !cmp.Equal(jrd, want) {
+		t.Errorf("Lookup returned %#v, want %#v", jrd, want)
+	}
+
+	jrd, err = client.Lookup("acct:bob@"+host, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if got, want := len(jrd.Links), 4; got != want {
+		t.Errorf("Lookup with no rels returned %d links, want %d", got, want)
+	}
+}
+
+func TestLookup_verifySubject(t *testing.T) {
+	tests := []struct {
+		description string
+		response    string
+		wantErr     bool
+	}{
+		{"matching subject", `{"subject":"acct:bob@%s"}`, false},
+		{"matching alias", `{"subject":"https://example.com/bob","aliases":["acct:bob@%s"]}`, false},
+		{"equivalent subject", `{"subject":"ACCT:%%62ob@%s"}`, false},
+		{"mismatch", `{"subject":"acct:alice@%s","aliases":["https://example.com/alice"]}`, true},
+	}
+
+	for _, tt := range tests {
+		client, mux, host, teardown := setup()
+		client.VerifySubject = true
+
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("content-type", "application/jrd+json")
+			fmt.Fprintf(w, tt.response, host)
+		})
+
+		_, err := client.Lookup("acct:bob@"+host, nil)
+		if tt.wantErr {
+			var se *SubjectMismatchError
+			if !errors.As(err, &se) {
+				t.Errorf("%s: Lookup returned %v, want *SubjectMismatchError", tt.description, err)
+			} else if se.Subject != "acct:alice@"+host || se.Resource != "acct:bob@"+host {
+				t.Errorf("%s: SubjectMismatchError is %#v", tt.description, se)
+			}
+		} else if err != nil {
+			t.Errorf("%s: Lookup returned unexpected error: %v", tt.description, err)
+		}
+		teardown()
+	}
+}
+
+func TestLookupAll(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.Concurrency = 2
+
+	var (
+		mu          sync.Mutex
+		inFlight    int
+		maxInFlight int
+	)
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		resource := r.FormValue("resource")
+		if strings.HasPrefix(resource, "acct:missing@") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{"subject":%q}`, resource)
+	})
+
+	identifiers := []string{
+		"acct:a@" + host,
+		"acct:b@" + host,
+		"acct:missing@" + host,
+		"acct:c@" + host,
+		"acct:d@" + host,
+		"bad",
+	}
+	jrds, errs := client.LookupAll(context.Background(), identifiers, nil)
+
+	for _, identifier := range []string{"acct:a@" + host, "acct:b@" + host, "acct:c@" + host, "acct:d@" + host} {
+		if jrd := jrds[identifier]; jrd == nil || jrd.Subject != identifier {
+			t.Errorf("LookupAll result for %q is %#v, want subject %q", identifier, jrd, identifier)
+		}
+	}
+	if len(jrds) != 4 {
+		t.Errorf("LookupAll returned %d JRDs, want 4", len(jrds))
+	}
+	if err := errs["acct:missing@"+host]; !IsNotFound(err) {
+		t.Errorf("LookupAll error for missing resource is %v, want not found error", err)
+	}
+	if errs["bad"] == nil {
+		t.Error("LookupAll did not return parse error for bad identifier")
+	}
+	if len(errs) != 2 {
+		t.Errorf("LookupAll returned %d errors, want 2", len(errs))
+	}
+	if maxInFlight > 2 {
+		t.Errorf("LookupAll performed %d concurrent lookups, want at most 2", maxInFlight)
+	}
+}
+
+func TestLookup_port(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	hostname, port, _ := net.SplitHostPort(host)
+	client.Port, _ = strconv.Atoi(port)
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.FormValue("resource"), "acct:bob@"+hostname; got != want {
+			t.Errorf("Requested resource: %v, want %v", got, want)
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	if _, err := client.Lookup("acct:bob@"+hostname, nil); err != nil {
+		t.Errorf("Unexpected error lookup up webfinger: %v", err)
+	}
+
+	r, _ := Parse("acct:bob@example.com:1234")
+	client.Port = 8443
+	if got, want := client.jrdURL(r, "", nil).Host, "example.com:8443"; got != want {
+		t.Errorf("jrdURL() has host %q, want %q", got, want)
+	}
+}
+
+func TestLookup_wellKnownPath(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.WellKnownPath = "/proxy/webfinger"
+
+	mux.HandleFunc("/proxy/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.FormValue("resource"), "acct:bob@"+host; got != want {
+			t.Errorf("Requested resource: %v, want %v", got, want)
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Errorf("Unexpected error lookup up webfinger: %v", err)
+	}
+
+	r, _ := Parse("acct:bob@example.com")
+	if got, want := client.jrdURL(r, "", nil).Path, "/proxy/webfinger"; got != want {
+		t.Errorf("jrdURL() has path %q, want %q", got, want)
+	}
+	if got, want := client.jrdURL(r, "localhost:8080", nil).String(), "https://localhost:8080/proxy/webfinger?resource=acct%3Abob%40example.com"; got != want {
+		t.Errorf("jrdURL() with host returned %q, want %q", got, want)
+	}
+}
+
+func TestClient_jrdURL(t *testing.T) {
+	tests := []struct {
+		mode     TransportMode
+		port     int
+		path     string
+		resource string
+		host     string
+		rels     []string
+		want     string
+	}{
+		{HTTPSOnly, 0, "", "acct:bob@example.com", "", nil, "https://example.com/.well-known/webfinger?resource=acct%3Abob%40example.com"},
+		{HTTPOnly, 8080, "/proxy/webfinger", "acct:bob@example.com", "", []string{"self"}, "http://example.com:8080/proxy/webfinger?rel=self&resource=acct%3Abob%40example.com"},
+		{HTTPSOnly, 8443, "", "acct:bob@bücher.example", "", nil, "https://xn--bcher-kva.example:8443/.well-known/webfinger?resource=acct%3Abob%40b%C3%BCcher.example"},
+		{HTTPSOnly, 8443, "/wf", "acct:bob@example.com", "bücher.example:1234", nil, "https://xn--bcher-kva.example:1234/wf?resource=acct%3Abob%40example.com"},
+	}
+	for _, tt := range tests {
+		client := NewClient(nil)
+		client.TransportMode = tt.mode
+		client.Port = tt.port
+		client.WellKnownPath = tt.path
+
+		r, err := Parse(tt.resource)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.resource, err)
+		}
+		if got := client.jrdURL(r, tt.host, tt.rels).String(); got != tt.want {
+			t.Errorf("jrdURL(%q, %q, %q) returned %q, want %q", tt.resource, tt.host, tt.rels, got, tt.want)
+		}
+	}
+}
+
+func TestLookupRaw(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.Cache = NewMemoryCache()
+	client.FilterRels = true
+
+	// formatting and field order that MarshalJSON would not reproduce
+	const body = `{ "links": [ {"rel": "self", "href": "https://example.com/bob"},
+	  {"rel": "other", "href": "https://example.com/other"} ],
+	  "subject": "acct:bob@example.com" }`
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, body)
+	})
+
+	for i := 0; i < 2; i++ {
+		raw, jrd, err := client.LookupRaw("acct:bob@"+host, []string{"self"})
+		if err != nil {
+			t.Fatalf("LookupRaw returned error: %v", err)
+		}
+		if string(raw) != body {
+			t.Errorf("LookupRaw returned body %q, want %q", raw, body)
+		}
+		want := &JRD{Subject: "acct:bob@example.com", Links: []Link{{Rel: "self", Href: "https://example.com/bob"}}}
+		if !cmp.Equal(jrd, want) {
+			t.Errorf("LookupRaw returned JRD %#v, want %#v", jrd, want)
+		}
+	}
+}
+
+func TestLookupResourceAt(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.FormValue("resource"), "acct:bob@example.com"; got != want {
+			t.Errorf("Requested resource: %v, want %v", got, want)
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"acct:bob@example.com"}`)
+	})
+
+	resource, _ := Parse("bob@example.com")
+	jrd, err := client.LookupResourceAt(resource, host, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if want := (&JRD{Subject: "acct:bob@example.com"}); !cmp.Equal(jrd, want) {
+		t.Errorf("LookupResourceAt returned %#v, want %#v", jrd, want)
+	}
+	if got, want := resource.String(), "acct:bob@example.com"; got != want {
+		t.Errorf("LookupResourceAt modified resource to %q, want %q", got, want)
+	}
+}
+
+func TestLookupResourceFull(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.Cache = NewMemoryCache()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "41")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	resource, _ := Parse("acct:bob@" + host)
+	jrd, res, err := client.LookupResourceFull(resource, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if want := (&JRD{Subject: "bob@example.com"}); !cmp.Equal(jrd, want) {
+		t.Errorf("LookupResourceFull returned %#v, want %#v", jrd, want)
+	}
+	if res == nil {
+		t.Fatal("LookupResourceFull returned nil response")
+	}
+	if got, want := res.Header.Get("X-RateLimit-Remaining"), "41"; got != want {
+		t.Errorf("X-RateLimit-Remaining header is %q, want %q", got, want)
+	}
+	if res.Body != http.NoBody {
+		t.Errorf("LookupResourceFull returned response body %v, want http.NoBody", res.Body)
+	}
+
+	// cached JRDs have no response
+	_, res, err = client.LookupResourceFull(resource, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if res != nil {
+		t.Errorf("LookupResourceFull from cache returned response %v, want nil", res)
+	}
+}
+
+func TestLookupResourceAt_tel(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.FormValue("resource"), "tel:+1-816-555-1212"; got != want {
+			t.Errorf("Requested resource: %v, want %v", got, want)
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"tel:+1-816-555-1212"}`)
+	})
+
+	resource, _ := Parse("tel:+1-816-555-1212")
+	if _, err := client.LookupResourceAt(resource, host, nil); err != nil {
+		t.Errorf("Unexpected error lookup up webfinger: %v", err)
+	}
+}
+
+func TestLookup_noHost(t *testing.T) {
+	client := NewClient(nil)
+	if _, err := client.Lookup("tel:+1-816-555-1212", nil); err == nil {
+		t.Error("Expected error looking up resource with no WebFinger host")
+	}
+}
+
+func TestLookup_parseError(t *testing.T) {
+	// use default client here, just to make sure that gets tested
+	_, err := Lookup("bob", nil)
+	if err == nil {
+		t.Error("Expected parse error")
+	}
+}
+
+func TestLookupContext_parseError(t *testing.T) {
+	// use default client here, just to make sure that gets tested
+	_, err := LookupContext(context.Background(), "bob", nil)
+	if err == nil {
+		t.Error("Expected parse error")
+	}
+}
+
+func TestLookupResource_noHost(t *testing.T) {
+	// use default client here, just to make sure that gets tested
+	resource, _ := Parse("tel:+1-816-555-1212")
+	if _, err := LookupResource(resource, nil); err == nil {
+		t.Error("Expected error for resource without host")
+	}
+	if _, err := LookupResourceContext(context.Background(), resource, nil); err == nil {
+		t.Error("Expected error for resource without host")
+	}
+}
+
+func TestSetDefaultClient(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	defer SetDefaultClient(nil)
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	// the default client does not trust the test server's certificate
+	if _, err := Lookup("acct:bob@"+host, nil); err == nil {
+		t.Error("Lookup with the original default client did not return expected error")
+	}
+
+	SetDefaultClient(client)
+	jrd, err := Lookup("acct:bob@"+host, nil)
+	if err != nil {
+		t.Fatalf("Lookup with installed default client returned error: %v", err)
+	}
+	if want := (&JRD{Subject: "bob@example.com"}); !cmp.Equal(jrd, want) {
+		t.Errorf("Lookup returned %#v, want %#v", jrd, want)
+	}
+
+	SetDefaultClient(nil)
+	if DefaultClient == client || DefaultClient == nil {
+		t.Errorf("SetDefaultClient(nil) installed %v, want a new client", DefaultClient)
+	}
+}
+
+func TestLookup_404(t *testing.T) {
+	client, _, host, teardown := setup()
+	defer teardown()
+
+	_, err := client.Lookup("bob@"+host, nil)
+	if err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestLookupContext_cancel(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	done := make(chan struct{})
+	defer close(done)
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := client.LookupContext(ctx, "acct:bob@"+host, nil)
+	if err != context.Canceled {
+		t.Errorf("LookupContext returned error %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("LookupContext took %v to return after cancel", elapsed)
+	}
+}
+
+func TestLookupContext_deadline(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	done := make(chan struct{})
+	defer close(done)
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		// send headers, then stall on the body
+		w.Header().Add("content-type", "application/jrd+json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"subject":`)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.LookupContext(ctx, "acct:bob@"+host, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("LookupContext returned error %v, want %v", err, context.DeadlineExceeded)
 	}
 }
@@ -2,24 +2,58 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"webfinger.net/go/webfinger"
 )
 
 var (
-	verbose = flag.Bool("v", false, "print details about the resolution")
+	verbose  = flag.Bool("v", false, "print details about the resolution")
+	output   = flag.String("o", "json", "output format: json, compact, or link")
+	timeout  = flag.Duration("timeout", 30*time.Second, "maximum time to wait for the lookup")
+	file     = flag.String("file", "", "read a JRD or XRD document from this file instead of looking up a resource")
+	validate = flag.Bool("validate", false, "report problems with the JRD instead of printing it")
+	rels     relFlag
 )
 
+func init() {
+	flag.Var(&rels, "rel", "request only links with this relation (may be repeated)")
+}
+
+// relFlag is a flag.Value that collects the values of a repeated flag.
+type relFlag []string
+
+func (f *relFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *relFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 func usage() {
-	fmt.Println("webfinger [-v] <resource uri>")
+	fmt.Println("webfinger [-v] [-o json|compact|link] [-timeout <duration>] [-rel <rel>]... <resource uri>")
+	fmt.Println("webfinger [-o json|compact|link] -file <path>")
+	fmt.Println("webfinger -validate [-file <path> | <resource uri>]")
 	flag.PrintDefaults()
 	fmt.Println("\nexample: webfinger -v bob@example.com") // same Bob as in the draft
+	fmt.Println("         webfinger -rel self -rel http://webfinger.net/rel/avatar bob@example.com")
+	fmt.Println("         webfinger -o link -file bob.jrd")
+	fmt.Println("         webfinger -validate bob@example.com")
+	fmt.Println("\nexit status: 0 on success, 2 if the resource has no webfinger data,")
+	fmt.Println("3 if -validate found problems, 1 on other errors")
 }
 
 func main() {
@@ -27,26 +61,149 @@ func main() {
 	flag.Parse()
 
 	resource := flag.Arg(0)
-	if resource == "" {
+	if (resource == "" && *file == "") || !validFormat(*output) {
 		flag.Usage()
-		os.Exit(1)
+		os.Exit(exitError)
 	}
-
-	log.SetFlags(0)
-	if !*verbose {
-		log.SetOutput(ioutil.Discard)
+	if *file != "" {
+		os.Exit(runFile(*file, os.Stdout))
 	}
 
 	client := webfinger.NewClient(nil)
-	client.AllowHTTP = true
+	client.TransportMode = webfinger.HTTPSWithFallback
+	if *verbose {
+		client.Log = &webfinger.StdLogger{Logger: log.New(os.Stderr, "", 0), Debug: true}
+	}
 
-	jrd, err := client.Lookup(resource, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	code := run(ctx, client, resource, os.Stdout)
+	cancel()
+	os.Exit(code)
+}
+
+// Exit codes of the webfinger tool.
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitNotFound = 2
+	exitInvalid  = 3
+)
+
+// run looks up resource with client, bound to ctx, and reports the result to
+// w, returning the tool's exit code.
+func run(ctx context.Context, client *webfinger.Client, resource string, w io.Writer) int {
+	start := time.Now()
+	body, jrd, err := client.LookupRawContext(ctx, resource, rels)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// the deadline may be ctx's or the client's, so report the time taken
+		fmt.Fprintf(w, "lookup of %s timed out: deadline exceeded after %v\n", resource, time.Since(start).Round(time.Millisecond))
+		return exitError
+	}
+	if errors.Is(err, webfinger.ErrNotFound) {
+		fmt.Fprintf(w, "no webfinger data found for %s\n", resource)
+		return exitNotFound
+	}
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintln(w, err)
+		return exitError
 	}
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	enc.Encode(jrd)
+	return report(w, jrd, body)
+}
+
+// report writes jrd to w in the selected output format or, with -validate,
+// writes the problems found with it, returning the tool's exit code.  raw is
+// the document jrd was parsed from; if it is a JRD, problems the parser
+// tolerated are reported too.
+func report(w io.Writer, jrd *webfinger.JRD, raw []byte) int {
+	if *validate {
+		err := jrd.Validate()
+		if !isXML(raw) {
+			_, err = webfinger.ParseAndValidateJRD(raw)
+		}
+		var verr *webfinger.ValidationError
+		if errors.As(err, &verr) {
+			for _, problem := range verr.Problems {
+				fmt.Fprintln(w, problem)
+			}
+			return exitInvalid
+		} else if err != nil {
+			fmt.Fprintln(w, err)
+			return exitError
+		}
+		fmt.Fprintln(w, "JRD is valid")
+		return exitOK
+	}
+	if err := writeJRD(w, jrd, *output); err != nil {
+		fmt.Fprintln(w, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// runFile reads the JRD or XRD document at path and reports it to w,
+// returning the tool's exit code.
+func runFile(path string, w io.Writer) int {
+	blob, jrd, err := readJRDFile(path)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return exitError
+	}
+	return report(w, jrd, blob)
+}
+
+// readJRDFile reads and parses the document at path, as an XRD if it starts
+// with "<" and as a JRD otherwise, returning both the document and the
+// parsed JRD.
+func readJRDFile(path string) ([]byte, *webfinger.JRD, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	parse := webfinger.ParseJRD
+	if isXML(blob) {
+		parse = webfinger.ParseXRD
+	}
+	jrd, err := parse(blob)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return blob, jrd, nil
+}
+
+// isXML reports whether the document blob appears to be XML rather than
+// JSON.
+func isXML(blob []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(blob), []byte("<"))
+}
+
+// validFormat reports whether format is an output format known to writeJRD.
+func validFormat(format string) bool {
+	return format == "json" || format == "compact" || format == "link"
+}
+
+// writeJRD writes jrd to w in the named output format: "json" for indented
+// JSON, "compact" for JSON without indentation, or "link" for the rel and
+// href (or template) of each link, one per line.
+func writeJRD(w io.Writer, jrd *webfinger.JRD, format string) error {
+	switch format {
+	case "json", "compact":
+		enc := json.NewEncoder(w)
+		if format == "json" {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(jrd)
+	case "link":
+		for _, link := range jrd.Links {
+			target := link.Href
+			if target == "" {
+				target = link.Template
+			}
+			if _, err := fmt.Fprintf(w, "%s %s\n", link.Rel, target); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q", format)
 }
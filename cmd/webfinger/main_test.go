@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"webfinger.net/go/webfinger"
+)
+
+func TestRelFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		want relFlag
+	}{
+		{[]string{"bob@example.com"}, nil},
+		{[]string{"-rel", "self", "bob@example.com"}, relFlag{"self"}},
+		{[]string{"-rel", "self", "-rel=http://webfinger.net/rel/avatar", "bob@example.com"}, relFlag{"self", "http://webfinger.net/rel/avatar"}},
+	}
+
+	for _, tt := range tests {
+		var got relFlag
+		fs := flag.NewFlagSet("webfinger", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		fs.Var(&got, "rel", "")
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.args, err)
+		}
+		if !cmp.Equal(got, tt.want) {
+			t.Errorf("Parse(%q) collected rels %q, want %q", tt.args, got, tt.want)
+		}
+		if got, want := fs.Arg(0), "bob@example.com"; got != want {
+			t.Errorf("Parse(%q) left argument %q, want %q", tt.args, got, want)
+		}
+	}
+}
+
+func TestWriteJRD(t *testing.T) {
+	jrd := &webfinger.JRD{
+		Subject: "acct:bob@example.com",
+		Links: []webfinger.Link{
+			{Rel: "self", Type: "application/activity+json", Href: "https://example.com/users/bob"},
+			{Rel: "http://ostatus.org/schema/1.0/subscribe", Template: "https://example.com/follow?uri={uri}"},
+		},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"json", `{
+  "subject": "acct:bob@example.com",
+  "links": [
+    {
+      "rel": "self",
+      "type": "application/activity+json",
+      "href": "https://example.com/users/bob"
+    },
+    {
+      "rel": "http://ostatus.org/schema/1.0/subscribe",
+      "template": "https://example.com/follow?uri={uri}"
+    }
+  ]
+}
+`},
+		{"compact", `{"subject":"acct:bob@example.com","links":[{"rel":"self","type":"application/activity+json","href":"https://example.com/users/bob"},{"rel":"http://ostatus.org/schema/1.0/subscribe","template":"https://example.com/follow?uri={uri}"}]}
+`},
+		{"link", `self https://example.com/users/bob
+http://ostatus.org/schema/1.0/subscribe https://example.com/follow?uri={uri}
+`},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeJRD(&buf, jrd, tt.format); err != nil {
+			t.Errorf("writeJRD(%q) returned error: %v", tt.format, err)
+			continue
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("writeJRD(%q) wrote %q, want %q", tt.format, got, tt.want)
+		}
+	}
+
+	if err := writeJRD(ioutil.Discard, jrd, "yaml"); err == nil {
+		t.Error("writeJRD with unknown format did not return expected error")
+	}
+}
+
+// testServer starts a WebFinger server that handles every request with
+// handler, and returns a client for it and the resource to look up.
+func testServer(handler http.HandlerFunc) (client *webfinger.Client, resource string, teardown func()) {
+	server := httptest.NewTLSServer(handler)
+	u, _ := url.Parse(server.URL)
+
+	client = webfinger.NewClient(&http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	})
+	return client, "acct:bob@" + u.Host, server.Close
+}
+
+func TestRun_exitCode(t *testing.T) {
+	tests := []struct {
+		status int
+		want   int
+	}{
+		{http.StatusOK, exitOK},
+		{http.StatusNotFound, exitNotFound},
+		{http.StatusGone, exitNotFound},
+		{http.StatusInternalServerError, exitError},
+	}
+
+	for _, tt := range tests {
+		client, resource, teardown := testServer(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("content-type", "application/jrd+json")
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, `{"subject":"acct:bob@example.com"}`)
+		})
+		var buf bytes.Buffer
+		if got := run(context.Background(), client, resource, &buf); got != tt.want {
+			t.Errorf("run with status %d returned %d, want %d; output: %s", tt.status, got, tt.want, buf.String())
+		}
+		teardown()
+	}
+}
+
+func TestRun_timeout(t *testing.T) {
+	done := make(chan struct{})
+	client, resource, teardown := testServer(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+	defer teardown()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var buf bytes.Buffer
+	if got := run(ctx, client, resource, &buf); got != exitError {
+		t.Errorf("run against slow server returned %d, want %d", got, exitError)
+	}
+	if got := buf.String(); !strings.Contains(got, "deadline exceeded after") {
+		t.Errorf("run against slow server printed %q, want timeout message", got)
+	}
+	if got := buf.String(); strings.Contains(got, timeout.String()) {
+		t.Errorf("run against slow server printed %q, want the time taken rather than -timeout", got)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"bob.jrd": `{"subject":"acct:bob@example.com","links":[{"rel":"self","href":"https://example.com/users/bob"}]}`,
+		"bob.xrd": `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+  <Subject>acct:bob@example.com</Subject>
+  <Link rel='self' href='https://example.com/users/bob' />
+</XRD>`,
+		"bad.jrd": `{"subject":`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(format string) { *output = format }(*output)
+	*output = "link"
+
+	tests := []struct {
+		name       string
+		want       int
+		wantOutput string
+	}{
+		{"bob.jrd", exitOK, "self https://example.com/users/bob\n"},
+		{"bob.xrd", exitOK, "self https://example.com/users/bob\n"},
+		{"bad.jrd", exitError, ""},
+		{"missing.jrd", exitError, ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if got := runFile(filepath.Join(dir, tt.name), &buf); got != tt.want {
+			t.Errorf("runFile(%q) returned %d, want %d; output: %s", tt.name, got, tt.want, buf.String())
+		}
+		if tt.want == exitOK && buf.String() != tt.wantOutput {
+			t.Errorf("runFile(%q) wrote %q, want %q", tt.name, buf.String(), tt.wantOutput)
+		}
+	}
+}
+
+func TestRun_validate(t *testing.T) {
+	defer func(v bool) { *validate = v }(*validate)
+	*validate = true
+
+	tests := []struct {
+		body         string
+		want         int
+		wantProblems []string
+	}{
+		{`{"subject":"acct:bob@example.com","links":[{"rel":"self","href":"https://example.com/users/bob"}]}`, exitOK, nil},
+		{`{"subject":"bob@example.com","links":[{"rel":"lrdd","href":"https://example.com/bob","template":"https://example.com/{uri}"}]}`, exitInvalid, []string{
+			`subject "bob@example.com" is not an absolute URI`,
+			"links[0] has both href and template",
+		}},
+		{`{"subject":"acct:bob@example.com","expires":"tomorrow"}`, exitInvalid, []string{`expires "tomorrow" is not a valid time`}},
+	}
+
+	for _, tt := range tests {
+		client, resource, teardown := testServer(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("content-type", "application/jrd+json")
+			fmt.Fprint(w, tt.body)
+		})
+		var buf bytes.Buffer
+		if got := run(context.Background(), client, resource, &buf); got != tt.want {
+			t.Errorf("run -validate for %s returned %d, want %d; output: %s", tt.body, got, tt.want, buf.String())
+		}
+		for _, problem := range tt.wantProblems {
+			if !strings.Contains(buf.String(), problem) {
+				t.Errorf("run -validate for %s printed %q, want problem %q", tt.body, buf.String(), problem)
+			}
+		}
+		teardown()
+	}
+}
@@ -0,0 +1,118 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrNotFound indicates that there is no WebFinger record for a resource.
+// A Client returns it (wrapped) when a server responds with 404 Not Found or
+// 410 Gone, and a ResolverFunc returns it (possibly wrapped) to have a Handler
+// respond with 404 Not Found.
+var ErrNotFound = errors.New("webfinger resource not found")
+
+// ErrUnexpectedContentType is returned (wrapped) when a WebFinger server
+// responds with a content type the Client does not accept for JRDs.
+var ErrUnexpectedContentType = errors.New("unexpected content type")
+
+// ErrUnsupportedCharset is returned (wrapped) when a WebFinger server responds
+// with a charset that cannot be decoded, or other than UTF-8 when the Client
+// requires UTF-8.
+var ErrUnsupportedCharset = errors.New("unsupported charset")
+
+// ErrUnsupportedScheme is returned (wrapped) by ParseStrict for a resource
+// whose scheme is not allowed.
+var ErrUnsupportedScheme = errors.New("unsupported resource scheme")
+
+// ErrEmptyResponse is returned (wrapped) when a WebFinger server responds
+// successfully but with an empty or whitespace-only body.
+var ErrEmptyResponse = errors.New("empty response body")
+
+// ErrInsecureURL is returned (wrapped) when host-meta discovery would fetch a
+// resource descriptor over HTTP and the Client's TransportMode is HTTPSOnly.
+var ErrInsecureURL = errors.New("insecure URL")
+
+// StatusError is returned when a WebFinger server responds with a non-2xx
+// HTTP status code.
+type StatusError struct {
+	// StatusCode is the HTTP status code of the response, e.g. 404.
+	StatusCode int
+
+	// Status is the HTTP status of the response, e.g. "404 Not Found".
+	Status string
+
+	// URL is the URL that was requested.
+	URL string
+}
+
+func (e *StatusError) Error() string {
+	if e.URL == "" {
+		return e.Status
+	}
+	return fmt.Sprintf("%s: %s", e.URL, e.Status)
+}
+
+// Unwrap returns ErrNotFound if the status code is 404 Not Found or 410 Gone,
+// so that errors.Is(err, ErrNotFound) reports whether there is no WebFinger
+// record for the requested resource.
+func (e *StatusError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// IsNotFound reports whether err indicates that the WebFinger server has no
+// record of the requested resource.  It is equivalent to
+// errors.Is(err, ErrNotFound).
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// ResponseTooLargeError is returned when a response body exceeds the
+// client's MaxResponseBytes.
+type ResponseTooLargeError struct {
+	// URL is the URL that was requested.
+	URL string
+
+	// Limit is the maximum number of bytes that could be read.
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("%s: response body exceeds %d bytes", e.URL, e.Limit)
+}
+
+// SubjectMismatchError is returned when a Client verifies the subject of a
+// JRD, and neither its subject nor any of its aliases match the resource that
+// was queried.
+type SubjectMismatchError struct {
+	// Resource is the resource that was queried.
+	Resource string
+
+	// Subject is the subject of the returned JRD.
+	Subject string
+}
+
+func (e *SubjectMismatchError) Error() string {
+	return fmt.Sprintf("JRD subject %q does not match resource %q", e.Subject, e.Resource)
+}
+
+// HostPolicyError is returned when a Client's HostPolicy denies a request to
+// a host.
+type HostPolicyError struct {
+	// Host is the host name that was denied.
+	Host string
+
+	// Err is the error returned by the HostPolicy.
+	Err error
+}
+
+func (e *HostPolicyError) Error() string {
+	return fmt.Sprintf("request to %s denied: %v", e.Host, e.Err)
+}
+
+func (e *HostPolicyError) Unwrap() error {
+	return e.Err
+}
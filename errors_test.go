@@ -0,0 +1,198 @@
+package webfinger
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	err := &StatusError{StatusCode: 404, Status: "404 Not Found", URL: "https://example.com/.well-known/webfinger"}
+	if got, want := err.Error(), "https://example.com/.well-known/webfinger: 404 Not Found"; got != want {
+		t.Errorf("Error() returned %q, want %q", got, want)
+	}
+}
+
+func TestHostPolicyError(t *testing.T) {
+	inner := errors.New("internal host")
+	err := &HostPolicyError{Host: "169.254.169.254", Err: inner}
+	if got, want := err.Error(), "request to 169.254.169.254 denied: internal host"; got != want {
+		t.Errorf("Error() returned %q, want %q", got, want)
+	}
+	if !errors.Is(err, inner) {
+		t.Errorf("HostPolicyError does not unwrap to its policy error")
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("404 Not Found"), false},
+		{&StatusError{StatusCode: 404}, true},
+		{fmt.Errorf("lookup: %w", &StatusError{StatusCode: 404}), true},
+		{&StatusError{StatusCode: 410}, true},
+		{ErrNotFound, true},
+		{&StatusError{StatusCode: 500}, false},
+	}
+	for _, tt := range tests {
+		if got := IsNotFound(tt.err); got != tt.want {
+			t.Errorf("IsNotFound(%v) returned %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestLookup_statusError(t *testing.T) {
+	for _, code := range []int{http.StatusNotFound, http.StatusTooManyRequests, http.StatusInternalServerError} {
+		client, mux, host, teardown := setup()
+		resource, _ := Parse("acct:bob@" + host)
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})
+
+		_, err := client.LookupResource(resource, nil)
+		var se *StatusError
+		if !errors.As(err, &se) {
+			t.Errorf("Lookup returned %v, want *StatusError", err)
+		} else if se.StatusCode != code {
+			t.Errorf("StatusError.StatusCode is %d, want %d", se.StatusCode, code)
+		} else if want := resource.JRDURL(nil).String(); se.URL != want {
+			t.Errorf("StatusError.URL is %q, want %q", se.URL, want)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_notFound(t *testing.T) {
+	for _, code := range []int{http.StatusNotFound, http.StatusGone} {
+		client, mux, host, teardown := setup()
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})
+
+		_, err := client.Lookup("acct:bob@"+host, nil)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Lookup with status %d returned %v, want ErrNotFound", code, err)
+		}
+		var se *StatusError
+		if !errors.As(err, &se) || se.StatusCode != code {
+			t.Errorf("Lookup with status %d returned %v, want *StatusError with that code", code, err)
+		}
+		teardown()
+	}
+
+	client, mux, host, teardown := setup()
+	defer teardown()
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	if _, err := client.Lookup("acct:bob@"+host, nil); errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup with status 500 returned %v, want error other than ErrNotFound", err)
+	}
+}
+
+func TestLookup_responseTooLarge(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.MaxResponseBytes = 64
+
+	body := `{"subject":"bob@example.com","aliases":["` + strings.Repeat("a", 100) + `"]}`
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, body)
+	})
+
+	_, err := client.Lookup("acct:bob@"+host, nil)
+	var tooLarge *ResponseTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Lookup returned %v, want *ResponseTooLargeError", err)
+	}
+	if tooLarge.Limit != 64 {
+		t.Errorf("ResponseTooLargeError.Limit is %d, want 64", tooLarge.Limit)
+	}
+
+	// a body exactly at the limit is accepted
+	client.MaxResponseBytes = int64(len(body))
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Errorf("Lookup with body at limit returned error: %v", err)
+	}
+
+	client.MaxResponseBytes = -1
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Errorf("Lookup with no limit returned error: %v", err)
+	}
+}
+
+func TestLookup_wrappedErrors(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		switch r.FormValue("resource") {
+		case "acct:syntax@" + host:
+			fmt.Fprint(w, `{"subject" "bob@example.com"}`)
+		case "acct:truncated@" + host:
+			fmt.Fprint(w, `{"subject":`)
+		case "acct:type@" + host:
+			fmt.Fprint(w, `{"subject":42}`)
+		case "acct:gzip@" + host:
+			w.Header().Set("Content-Encoding", "gzip")
+			fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+		}
+	})
+
+	_, err := client.Lookup("acct:syntax@"+host, nil)
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("Lookup with malformed JRD returned %v, want *json.SyntaxError", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), host) {
+		t.Errorf("Lookup with malformed JRD returned %q, want error naming the URL", err)
+	}
+
+	// JRDs are parsed as they are read, so truncation is reported as such
+	_, err = client.Lookup("acct:truncated@"+host, nil)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Lookup with truncated JRD returned %v, want io.ErrUnexpectedEOF", err)
+	}
+
+	_, err = client.Lookup("acct:type@"+host, nil)
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("Lookup with mistyped JRD returned %v, want *json.UnmarshalTypeError", err)
+	}
+
+	_, err = client.Lookup("acct:gzip@"+host, nil)
+	if !errors.Is(err, gzip.ErrHeader) {
+		t.Errorf("Lookup with invalid gzip body returned %v, want gzip.ErrHeader", err)
+	}
+}
+
+func TestLookup_wrappedErrorsHostMeta(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.AllowHostMeta = true
+
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/xrd+xml")
+		fmt.Fprint(w, `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'><Link`)
+	})
+	mux.HandleFunc("/.well-known/host-meta.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/json")
+		fmt.Fprint(w, `{"links":`)
+	})
+
+	_, err := client.Lookup("acct:bob@"+host, nil)
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("Lookup with malformed host-meta returned %v, want *json.SyntaxError", err)
+	}
+}
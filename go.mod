@@ -1,5 +1,9 @@
 module webfinger.net/go/webfinger
 
-go 1.12
+go 1.18
 
-require github.com/google/go-cmp v0.5.9 // indirect
+require (
+	github.com/google/go-cmp v0.5.9
+	golang.org/x/net v0.17.0
+	golang.org/x/text v0.13.0
+)
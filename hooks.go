@@ -0,0 +1,42 @@
+package webfinger
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RequestInfo describes a completed HTTP request, as passed to
+// Client.OnRequestEnd.
+type RequestInfo struct {
+	// URL is the URL that was requested.  If redirects were followed, it is
+	// the URL of the original request.
+	URL *url.URL
+
+	// StatusCode is the HTTP status code of the final response, or zero if no
+	// response was received.
+	StatusCode int
+
+	// Duration is the time taken to receive the response headers.
+	Duration time.Duration
+
+	// Err is the error that prevented a response being received, if any.
+	Err error
+}
+
+// send sends a single attempt of req, calling the client's request hooks.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if c.OnRequestStart != nil {
+		c.OnRequestStart(req.URL)
+	}
+	start := time.Now()
+	res, err := c.httpClient().Do(req)
+	if c.OnRequestEnd != nil {
+		info := RequestInfo{URL: req.URL, Duration: time.Since(start), Err: err}
+		if res != nil {
+			info.StatusCode = res.StatusCode
+		}
+		c.OnRequestEnd(info)
+	}
+	return res, err
+}
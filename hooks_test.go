@@ -0,0 +1,68 @@
+package webfinger
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestLookup_hooks(t *testing.T) {
+	tests := []struct {
+		status  int
+		wantErr bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		client, mux, host, teardown := setup()
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("content-type", "application/jrd+json")
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+		})
+
+		var started []*url.URL
+		var ended []RequestInfo
+		client.OnRequestStart = func(u *url.URL) { started = append(started, u) }
+		client.OnRequestEnd = func(info RequestInfo) { ended = append(ended, info) }
+
+		resource, _ := Parse("acct:bob@" + host)
+		_, err := client.LookupResource(resource, nil)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("Lookup with status %d returned error %v, want error: %v", tt.status, err, tt.wantErr)
+		}
+
+		want := resource.JRDURL(nil).String()
+		if len(started) != 1 || started[0].String() != want {
+			t.Errorf("OnRequestStart called with %v, want [%s]", started, want)
+		}
+		if len(ended) != 1 {
+			t.Fatalf("OnRequestEnd called %d times, want 1", len(ended))
+		}
+		if got := ended[0]; got.URL.String() != want || got.StatusCode != tt.status || got.Err != nil || got.Duration <= 0 {
+			t.Errorf("OnRequestEnd called with %+v, want URL %s and status %d", got, want, tt.status)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_hooksNetworkError(t *testing.T) {
+	client, _, host, teardown := setup()
+	teardown()
+
+	var ended []RequestInfo
+	client.OnRequestEnd = func(info RequestInfo) { ended = append(ended, info) }
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); err == nil {
+		t.Fatal("Lookup against closed server did not return an error")
+	}
+	if len(ended) != 1 {
+		t.Fatalf("OnRequestEnd called %d times, want 1", len(ended))
+	}
+	if got := ended[0]; got.StatusCode != 0 || got.Err == nil {
+		t.Errorf("OnRequestEnd called with %+v, want zero status and an error", got)
+	}
+}
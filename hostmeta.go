@@ -0,0 +1,183 @@
+package webfinger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Well-known paths of a host's host-meta document in its XRD and JSON forms,
+// as defined in RFC 6415.
+const (
+	hostMetaPath     = "/.well-known/host-meta"
+	hostMetaJSONPath = "/.well-known/host-meta.json"
+)
+
+// FetchHostMeta fetches the host-meta document of host, as defined in RFC
+// 6415, and returns it as a JRD.  The XRD and JSON host-meta documents are
+// requested concurrently, and whichever is fetched first is returned.
+func (c *Client) FetchHostMeta(host string) (*JRD, error) {
+	return c.FetchHostMetaContext(context.Background(), host)
+}
+
+// FetchHostMetaContext is like FetchHostMeta, but the request is bound to ctx.
+// If ctx is cancelled or its deadline expires before the request completes,
+// ctx.Err() is returned.
+func (c *Client) FetchHostMetaContext(ctx context.Context, host string) (*JRD, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	hostMeta, err := c.fetchHostMeta(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return hostMeta.jrd, nil
+}
+
+// fetchHostMeta fetches the host-meta document of host.  The XRD and JSON
+// documents are requested concurrently, and the first to be fetched
+// successfully is returned, cancelling the other request.  If both fail, the
+// error for the JSON document is returned.
+func (c *Client) fetchHostMeta(ctx context.Context, host string) (*fetchResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type outcome struct {
+		path   string
+		result *fetchResult
+		err    error
+	}
+	paths := []string{hostMetaPath, hostMetaJSONPath}
+	outcomes := make(chan outcome, len(paths))
+	for _, path := range paths {
+		go func(path string) {
+			result, err := c.fetchDescriptor(ctx, &url.URL{Scheme: c.scheme(), Host: host, Path: path})
+			outcomes <- outcome{path, result, err}
+		}(path)
+	}
+
+	var err error
+	for range paths {
+		o := <-outcomes
+		if o.err == nil {
+			return o.result, nil
+		}
+		c.infof("Fetching %s failed (%v)", o.path, o.err)
+		if err == nil || o.path == hostMetaJSONPath {
+			err = o.err
+		}
+	}
+	return nil, err
+}
+
+// lookupHostMeta looks up resource using the legacy host-meta discovery flow:
+// the host-meta document of the resource's host is fetched, and its lrdd link
+// template is expanded with the resource to locate the resource's descriptor.
+// The host-meta documents are fetched from host.
+func (c *Client) lookupHostMeta(ctx context.Context, resource *Resource, host string) (*fetchResult, error) {
+	hostMeta, err := c.fetchHostMeta(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	link := lrddLink(hostMeta.jrd)
+	if link == nil {
+		return nil, fmt.Errorf("host-meta for %s has no lrdd template", host)
+	}
+	target, err := link.ExpandTemplate(resource.String())
+	if err != nil {
+		return nil, fmt.Errorf("expanding lrdd template of host-meta for %s: %w", host, err)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.fetchDescriptor(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	result.source = SourceHostMeta
+	return result, nil
+}
+
+// lrddLink returns the lrdd link template of a host-meta document, preferring
+// one which describes a JRD.
+func lrddLink(hostMeta *JRD) *Link {
+	var found *Link
+	for _, link := range hostMeta.GetLinksByRel("lrdd") {
+		if link.Template == "" {
+			continue
+		}
+		if link.Type == jrdMediaType {
+			return link
+		}
+		if found == nil {
+			found = link
+		}
+	}
+	return found
+}
+
+// fetchDescriptor fetches the XRD or JRD document at u.  The document format
+// is determined by the response content type.  Since u may come from a
+// server-supplied lrdd template, URLs other than https are rejected in
+// HTTPSOnly mode.
+func (c *Client) fetchDescriptor(ctx context.Context, u *url.URL) (*fetchResult, error) {
+	if c.transportMode() == HTTPSOnly && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w %s", ErrInsecureURL, u)
+	}
+	if err := c.checkHost(u); err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, u, xrdMediaType+", "+jrdMediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(res); err != nil {
+		return nil, err
+	}
+
+	var isXML, known bool
+	switch responseMediaType(res) {
+	case xrdMediaType, "application/xml", "text/xml":
+		isXML, known = true, true
+	case jrdMediaType, "application/json":
+		known = true
+	default:
+		if !c.IgnoreContentType {
+			res.Body.Close()
+			return nil, fmt.Errorf("%w %q from %s", ErrUnexpectedContentType, res.Header.Get("Content-Type"), u)
+		}
+	}
+
+	content, err := c.readBody(req, res)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.verifyResponse(res, content); err != nil {
+		return nil, err
+	}
+
+	if !known {
+		isXML = bytes.HasPrefix(bytes.TrimSpace(content), []byte("<"))
+	}
+	parse := ParseJRD
+	if isXML {
+		parse = ParseXRD
+	}
+	jrd, err := parse(content)
+	if err != nil {
+		return nil, bodyError(ctx, fmt.Errorf("parsing descriptor from %s: %w", u, err))
+	}
+	return &fetchResult{jrd: jrd, res: res, body: content, source: SourceHTTP, url: responseURL(res, u)}, nil
+}
@@ -0,0 +1,273 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLookup_hostMeta(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.AllowHostMeta = true
+
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/xrd+xml")
+		fmt.Fprintf(w, `<?xml version='1.0' encoding='UTF-8'?>
+			<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+			  <Link rel='lrdd' type='application/xrd+xml' template='https://%s/lrdd.xml?uri={uri}' />
+			  <Link rel='lrdd' type='application/jrd+json' template='https://%s/lrdd?uri={uri}' />
+			</XRD>`, host, host)
+	})
+	mux.HandleFunc("/lrdd", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.FormValue("uri"), "acct:bob@"+host; got != want {
+			t.Errorf("lrdd uri is %q, want %q", got, want)
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	jrd, err := client.Lookup("acct:bob@"+host, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if want := (&JRD{Subject: "bob@example.com"}); !cmp.Equal(jrd, want) {
+		t.Errorf("Lookup returned %#v, want %#v", jrd, want)
+	}
+}
+
+func TestLookup_hostMetaXRD(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.AllowHostMeta = true
+
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/xrd+xml")
+		fmt.Fprintf(w, `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+			  <Link rel='lrdd' template='https://%s/lrdd?uri={uri}' />
+			</XRD>`, host)
+	})
+	mux.HandleFunc("/lrdd", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/xrd+xml")
+		fmt.Fprint(w, `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+			  <Subject>acct:bob@example.com</Subject>
+			</XRD>`)
+	})
+
+	jrd, err := client.Lookup("acct:bob@"+host, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if want := (&JRD{Subject: "acct:bob@example.com"}); !cmp.Equal(jrd, want) {
+		t.Errorf("Lookup returned %#v, want %#v", jrd, want)
+	}
+}
+
+func TestLookup_hostMetaJSON(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.AllowHostMeta = true
+
+	mux.HandleFunc("/.well-known/host-meta.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/json")
+		fmt.Fprintf(w, `{"links":[{"rel":"lrdd","template":"https://%s/lrdd?uri={uri}"}]}`, host)
+	})
+	mux.HandleFunc("/lrdd", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.FormValue("uri"), "acct:bob@"+host; got != want {
+			t.Errorf("lrdd uri is %q, want %q", got, want)
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	jrd, err := client.Lookup("acct:bob@"+host, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if want := (&JRD{Subject: "bob@example.com"}); !cmp.Equal(jrd, want) {
+		t.Errorf("Lookup returned %#v, want %#v", jrd, want)
+	}
+}
+
+func TestLookup_hostMetaDisabled(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("host-meta requested when AllowHostMeta is false")
+	})
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestLookup_hostMetaNoTemplate(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.AllowHostMeta = true
+
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/xrd+xml")
+		fmt.Fprint(w, `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+			  <Link rel='copyright' href='http://example.com/copyright' />
+			</XRD>`)
+	})
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); err == nil {
+		t.Error("Expected error for host-meta without lrdd template")
+	}
+}
+
+func TestLookup_hostMetaInsecureTemplate(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.AllowHostMeta = true
+
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/xrd+xml")
+		fmt.Fprintf(w, `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+			  <Link rel='lrdd' template='http://%s/lrdd?uri={uri}' />
+			</XRD>`, host)
+	})
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); !errors.Is(err, ErrInsecureURL) {
+		t.Errorf("Lookup with http lrdd template returned %v, want ErrInsecureURL", err)
+	}
+}
+
+func TestFetchHostMeta(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/xrd+xml")
+		fmt.Fprint(w, `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+			  <Link rel='lrdd' type='application/jrd+json' template='https://example.com/lrdd?uri={uri}' />
+			  <Link rel='copyright' href='http://example.com/copyright' />
+			</XRD>`)
+	})
+
+	jrd, err := client.FetchHostMeta(host)
+	if err != nil {
+		t.Fatalf("FetchHostMeta returned error: %v", err)
+	}
+	want := &JRD{Links: []Link{
+		{Rel: "lrdd", Type: "application/jrd+json", Template: "https://example.com/lrdd?uri={uri}"},
+		{Rel: "copyright", Href: "http://example.com/copyright"},
+	}}
+	if !cmp.Equal(jrd, want) {
+		t.Errorf("FetchHostMeta returned %#v, want %#v", jrd, want)
+	}
+}
+
+func TestFetchHostMeta_json(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/host-meta.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/json")
+		fmt.Fprint(w, `{"links":[{"rel":"lrdd","template":"https://example.com/lrdd?uri={uri}"}]}`)
+	})
+
+	jrd, err := client.FetchHostMeta(host)
+	if err != nil {
+		t.Fatalf("FetchHostMeta returned error: %v", err)
+	}
+	want := &JRD{Links: []Link{{Rel: "lrdd", Template: "https://example.com/lrdd?uri={uri}"}}}
+	if !cmp.Equal(jrd, want) {
+		t.Errorf("FetchHostMeta returned %#v, want %#v", jrd, want)
+	}
+}
+
+func TestFetchHostMeta_notFound(t *testing.T) {
+	client, _, host, teardown := setup()
+	defer teardown()
+
+	if _, err := client.FetchHostMeta(host); !IsNotFound(err) {
+		t.Errorf("FetchHostMeta returned %v, want not found error", err)
+	}
+}
+
+func TestFetchHostMeta_race(t *testing.T) {
+	for _, slow := range []string{"/.well-known/host-meta", "/.well-known/host-meta.json"} {
+		client, mux, host, teardown := setup()
+
+		started := make(chan struct{})
+		cancelled := make(chan struct{})
+		done := make(chan struct{})
+		handlers := map[string]http.HandlerFunc{
+			"/.well-known/host-meta": func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("content-type", "application/xrd+xml")
+				fmt.Fprint(w, `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+				  <Link rel='lrdd' template='https://example.com/lrdd?uri={uri}' />
+				</XRD>`)
+			},
+			"/.well-known/host-meta.json": func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("content-type", "application/json")
+				fmt.Fprint(w, `{"links":[{"rel":"lrdd","template":"https://example.com/lrdd?uri={uri}"}]}`)
+			},
+		}
+		for path, handler := range handlers {
+			if path == slow {
+				handler = func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					select {
+					case <-r.Context().Done():
+						close(cancelled)
+					case <-done:
+					case <-time.After(10 * time.Second):
+					}
+				}
+			} else {
+				// respond only once the slow request is in progress, so
+				// that there is a request to cancel
+				fast := handler
+				handler = func(w http.ResponseWriter, r *http.Request) {
+					<-started
+					fast(w, r)
+				}
+			}
+			mux.HandleFunc(path, handler)
+		}
+
+		start := time.Now()
+		jrd, err := client.FetchHostMeta(host)
+		if err != nil {
+			t.Fatalf("FetchHostMeta with slow %s returned error: %v", slow, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("FetchHostMeta with slow %s took %v, want it not to wait for the slow request", slow, elapsed)
+		}
+		want := &JRD{Links: []Link{{Rel: "lrdd", Template: "https://example.com/lrdd?uri={uri}"}}}
+		if !cmp.Equal(jrd, want) {
+			t.Errorf("FetchHostMeta with slow %s returned %#v, want %#v", slow, jrd, want)
+		}
+
+		select {
+		case <-cancelled:
+		case <-time.After(5 * time.Second):
+			t.Errorf("FetchHostMeta did not cancel the request for slow %s", slow)
+		}
+		close(done)
+		teardown()
+	}
+}
+
+func TestFetchHostMeta_bothFail(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	// the error for host-meta.json is returned
+	if _, err := client.FetchHostMeta(host); !IsNotFound(err) {
+		t.Errorf("FetchHostMeta returned %v, want not found error", err)
+	}
+}
@@ -5,7 +5,15 @@
 package webfinger
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -29,24 +37,496 @@ type Link struct {
 	Template   string                 `json:"template,omitempty"`
 }
 
-// ParseJRD parses the JRD using json.Unmarshal.
+// ParseJRD parses the JRD using json.Unmarshal.  If an entry of the links
+// array is not a valid link, the error names its index.  The expires time is
+// parsed as RFC 3339, or failing that as one of a few formats used by
+// non-conforming servers; if it cannot be parsed, Expires is left nil rather
+// than failing the whole document.
 func ParseJRD(blob []byte) (*JRD, error) {
+	jrd, _, err := parseJRD(blob, false)
+	return jrd, err
+}
+
+// ParseJRDLenient is like ParseJRD, but skips entries of the links array that
+// are not valid links, such as strings or numbers, rather than failing.
+func ParseJRDLenient(blob []byte) (*JRD, error) {
+	jrd, _, err := parseJRD(blob, true)
+	return jrd, err
+}
+
+// jrdFields has the fields of a JRD, without its methods.
+type jrdFields JRD
+
+// parseJRD parses the JRD in blob, decoding each link separately so that
+// invalid links can be reported or, if skipInvalid is set, skipped.  Problems
+// that did not prevent parsing, such as an unparseable expires time, are
+// returned as warnings.
+func parseJRD(blob []byte, skipInvalid bool) (jrd *JRD, warnings []string, err error) {
+	var raw struct {
+		jrdFields
+		Expires json.RawMessage   `json:"expires,omitempty"`
+		Links   []json.RawMessage `json:"links,omitempty"`
+	}
+	if err := json.Unmarshal(blob, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	jrd = (*JRD)(&raw.jrdFields)
+	if raw.Expires != nil {
+		expires, err := parseExpires(raw.Expires)
+		if err != nil {
+			warnings = append(warnings, err.Error())
+		}
+		jrd.Expires = expires
+	}
+	if raw.Links != nil {
+		jrd.Links = make([]Link, 0, len(raw.Links))
+	}
+	for i, rawLink := range raw.Links {
+		var link Link
+		if err := json.Unmarshal(rawLink, &link); err != nil {
+			if skipInvalid {
+				continue
+			}
+			return nil, nil, fmt.Errorf("invalid JRD link at index %d: %w", i, err)
+		}
+		jrd.Links = append(jrd.Links, link)
+	}
+	return jrd, warnings, nil
+}
+
+// expiresFormats are the layouts tried, in order, for a JRD expires time that
+// is not in RFC 3339 format.
+var expiresFormats = []string{
+	http.TimeFormat,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02T15:04:05", // RFC 3339 without a time zone, taken as UTC
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+}
+
+// parseExpires parses the raw JSON value of a JRD expires time.  A null value
+// yields a nil time.  An error is returned, with a nil time, if the value is
+// not a string in RFC 3339 or one of expiresFormats.
+func parseExpires(raw json.RawMessage) (*time.Time, error) {
+	var v *string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("expires %s is not a string", raw)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, *v); err == nil {
+		return &t, nil
+	}
+	for _, layout := range expiresFormats {
+		if t, err := time.Parse(layout, *v); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("expires %q is not a valid time", *v)
+}
+
+// ParseJRDReader is like ParseJRD, but reads the JRD from r, decoding one
+// link at a time rather than buffering the whole document.  It is intended
+// for very large JRDs, such as those with thousands of links.
+func ParseJRDReader(r io.Reader) (*JRD, error) {
+	jrd, _, err := parseJRDReader(r)
+	return jrd, err
+}
+
+// parseJRDReader parses a JRD as described for ParseJRDReader.  Problems that
+// did not prevent parsing are returned as warnings, as by parseJRD.
+func parseJRDReader(r io.Reader) (*JRD, []string, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, nil, err
+	}
+
 	jrd := JRD{}
-	err := json.Unmarshal(blob, &jrd)
+	var warnings []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, _ := tok.(string)
+
+		// Keys are matched case-insensitively, as by json.Unmarshal.
+		var field interface{}
+		switch strings.ToLower(key) {
+		case "subject":
+			field = &jrd.Subject
+		case "expires":
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, nil, err
+			}
+			expires, err := parseExpires(raw)
+			if err != nil {
+				warnings = append(warnings, err.Error())
+			}
+			jrd.Expires = expires
+			continue
+		case "aliases":
+			field = &jrd.Aliases
+		case "properties":
+			field = &jrd.Properties
+		case "links":
+			links, err := decodeLinks(dec)
+			if err != nil {
+				return nil, nil, err
+			}
+			jrd.Links = links
+			continue
+		default:
+			field = new(json.RawMessage)
+		}
+		if err := dec.Decode(field); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, errors.New("unexpected data after JRD")
+	}
+	return &jrd, warnings, nil
+}
+
+// decodeLinks decodes a JSON array of links from dec one link at a time.  A
+// null array decodes to nil links.
+func decodeLinks(dec *json.Decoder) ([]Link, error) {
+	tok, err := dec.Token()
 	if err != nil {
 		return nil, err
 	}
+	if tok == nil {
+		return nil, nil
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("invalid JRD links: unexpected %v", tok)
+	}
+
+	links := []Link{}
+	for i := 0; dec.More(); i++ {
+		var link Link
+		if err := dec.Decode(&link); err != nil {
+			return nil, fmt.Errorf("invalid JRD link at index %d: %w", i, err)
+		}
+		links = append(links, link)
+	}
+	return links, expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token from dec, returning an error unless it is
+// the delimiter delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("invalid JRD: expected %v, got %v", delim, tok)
+	}
+	return nil
+}
+
+// ParseJRDStrict is like ParseJRD, but rejects documents containing fields
+// not defined for a JRD or link, such as a misspelt "alias" for "aliases".
+// It is intended for servers checking their own output; clients should use
+// the lenient ParseJRD.
+func ParseJRDStrict(blob []byte) (*JRD, error) {
+	dec := json.NewDecoder(bytes.NewReader(blob))
+	dec.DisallowUnknownFields()
+	jrd := JRD{}
+	if err := dec.Decode(&jrd); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JRD")
+	}
 	return &jrd, nil
 }
 
+// MarshalJSON encodes the JRD as JSON.  Empty fields are omitted, null
+// property values are encoded as null, and the expires time is encoded in
+// RFC 3339 format in UTC.
+func (jrd JRD) MarshalJSON() ([]byte, error) {
+	var expires string
+	if jrd.Expires != nil {
+		expires = jrd.Expires.UTC().Format(time.RFC3339Nano)
+	}
+	return json.Marshal(struct {
+		Subject    string                 `json:"subject,omitempty"`
+		Expires    string                 `json:"expires,omitempty"`
+		Aliases    []string               `json:"aliases,omitempty"`
+		Properties map[string]interface{} `json:"properties,omitempty"`
+		Links      []Link                 `json:"links,omitempty"`
+	}{
+		Subject:    jrd.Subject,
+		Expires:    expires,
+		Aliases:    jrd.Aliases,
+		Properties: jrd.Properties,
+		Links:      jrd.Links,
+	})
+}
+
+// ParseAndValidateJRD parses the JRD using ParseJRD, then checks it with
+// Validate.  Problems that ParseJRD tolerates, such as an unparseable expires
+// time, are also reported in the *ValidationError.
+func ParseAndValidateJRD(blob []byte) (*JRD, error) {
+	jrd, problems, err := parseJRD(blob, false)
+	if err != nil {
+		return nil, err
+	}
+	var verr *ValidationError
+	if err := jrd.Validate(); errors.As(err, &verr) {
+		problems = append(problems, verr.Problems...)
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return jrd, nil
+}
+
+// ValidationError describes the ways in which a JRD does not conform to the
+// WebFinger spec.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid JRD: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that the JRD conforms to the structural rules of the
+// WebFinger spec that are not enforced by ParseJRD.  If it does not, a
+// *ValidationError listing each problem is returned.
+func (jrd *JRD) Validate() error {
+	var problems []string
+	if jrd.Subject != "" {
+		if u, err := url.Parse(jrd.Subject); err != nil || !u.IsAbs() {
+			problems = append(problems, fmt.Sprintf("subject %q is not an absolute URI", jrd.Subject))
+		}
+	}
+	if jrd.Expires != nil && jrd.Expires.IsZero() {
+		problems = append(problems, "expires is the zero time")
+	}
+	for i, alias := range jrd.Aliases {
+		if alias == "" {
+			problems = append(problems, fmt.Sprintf("aliases[%d] is empty", i))
+		}
+	}
+	for i, link := range jrd.Links {
+		if link.Href != "" && link.Template != "" {
+			problems = append(problems, fmt.Sprintf("links[%d] has both href and template", i))
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// IsExpired reports whether the JRD has an expiry time that has passed.
+func (jrd *JRD) IsExpired() bool {
+	return jrd.IsExpiredAt(time.Now())
+}
+
+// IsExpiredAt reports whether the JRD has an expiry time before t.
+func (jrd *JRD) IsExpiredAt(t time.Time) bool {
+	return jrd.Expires != nil && jrd.Expires.Before(t)
+}
+
+// HasAlias reports whether alias is one of the JRD's aliases.  Aliases are
+// compared exactly.
+func (jrd *JRD) HasAlias(alias string) bool {
+	for _, a := range jrd.Aliases {
+		if a == alias {
+			return true
+		}
+	}
+	return false
+}
+
 // GetLinkByRel returns the first *Link with the specified rel value.
 func (jrd *JRD) GetLinkByRel(rel string) *Link {
+	links := jrd.GetLinksByRel(rel)
+	if len(links) == 0 {
+		return nil
+	}
+	return links[0]
+}
+
+// GetLinksByRel returns all links with the specified rel value, in document
+// order.  An empty slice is returned if no links match.
+func (jrd *JRD) GetLinksByRel(rel string) []*Link {
+	links := []*Link{}
+	for i := range jrd.Links {
+		if jrd.Links[i].Rel == rel {
+			links = append(links, &jrd.Links[i])
+		}
+	}
+	return links
+}
+
+// Rels returns the distinct rel values of the JRD's links, sorted.
+func (jrd *JRD) Rels() []string {
+	seen := make(map[string]bool, len(jrd.Links))
+	rels := []string{}
 	for _, link := range jrd.Links {
-		if link.Rel == rel {
-			return &link
+		if !seen[link.Rel] {
+			seen[link.Rel] = true
+			rels = append(rels, link.Rel)
 		}
 	}
-	return nil
+	sort.Strings(rels)
+	return rels
+}
+
+// SelectRels returns a copy of the JRD containing only the links whose rel is
+// one of rels, in their original order.  The subject, aliases and properties
+// are kept.  If rels is empty, the JRD itself is returned.
+func (jrd *JRD) SelectRels(rels []string) *JRD {
+	if len(rels) == 0 {
+		return jrd
+	}
+	want := make(map[string]bool, len(rels))
+	for _, rel := range rels {
+		want[rel] = true
+	}
+
+	filtered := *jrd
+	filtered.Links = nil
+	for _, link := range jrd.Links {
+		if want[link.Rel] {
+			filtered.Links = append(filtered.Links, link)
+		}
+	}
+	return &filtered
+}
+
+// Merge returns a new JRD combining jrd with other, such as the results of
+// lookups for different rels.  Conflicts are resolved as follows:
+//
+//   - the subject and aliases are those of jrd;
+//   - the expires time is the sooner of the two;
+//   - properties are merged, with those of other taking precedence;
+//   - links of jrd come first, followed by links of other that do not have
+//     the same rel and href (or template) as a link already included.
+//
+// Neither jrd nor other is modified, though the result may share link
+// titles and properties with them.
+func (jrd *JRD) Merge(other *JRD) *JRD {
+	merged := *jrd
+	merged.Aliases = append([]string(nil), jrd.Aliases...)
+	merged.Links = append([]Link(nil), jrd.Links...)
+	if other == nil {
+		return &merged
+	}
+
+	if other.Expires != nil && (merged.Expires == nil || other.Expires.Before(*merged.Expires)) {
+		merged.Expires = other.Expires
+	}
+
+	if len(other.Properties) > 0 {
+		merged.Properties = make(map[string]interface{}, len(jrd.Properties)+len(other.Properties))
+		for k, v := range jrd.Properties {
+			merged.Properties[k] = v
+		}
+		for k, v := range other.Properties {
+			merged.Properties[k] = v
+		}
+	}
+
+	type linkKey struct{ rel, target string }
+	key := func(link Link) linkKey {
+		if link.Href != "" {
+			return linkKey{link.Rel, link.Href}
+		}
+		return linkKey{link.Rel, link.Template}
+	}
+	seen := make(map[linkKey]bool, len(merged.Links))
+	for _, link := range merged.Links {
+		seen[key(link)] = true
+	}
+	for _, link := range other.Links {
+		if k := key(link); !seen[k] {
+			seen[k] = true
+			merged.Links = append(merged.Links, link)
+		}
+	}
+	return &merged
+}
+
+// Clone returns a deep copy of the JRD, which may be modified without
+// affecting jrd.
+func (jrd *JRD) Clone() *JRD {
+	clone := *jrd
+	if jrd.Expires != nil {
+		expires := *jrd.Expires
+		clone.Expires = &expires
+	}
+	if jrd.Aliases != nil {
+		clone.Aliases = append([]string{}, jrd.Aliases...)
+	}
+	clone.Properties = cloneProperties(jrd.Properties)
+	if jrd.Links != nil {
+		clone.Links = make([]Link, len(jrd.Links))
+		for i, link := range jrd.Links {
+			if link.Titles != nil {
+				titles := make(map[string]string, len(link.Titles))
+				for k, v := range link.Titles {
+					titles[k] = v
+				}
+				link.Titles = titles
+			}
+			link.Properties = cloneProperties(link.Properties)
+			clone.Links[i] = link
+		}
+	}
+	return &clone
+}
+
+// cloneProperties returns a copy of props, or nil if props is nil.
+func cloneProperties(props map[string]interface{}) map[string]interface{} {
+	if props == nil {
+		return nil
+	}
+	clone := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		clone[k] = v
+	}
+	return clone
+}
+
+// GetLinkByType returns the first *Link with the specified media type.  Media
+// types are compared case-insensitively.
+func (jrd *JRD) GetLinkByType(mediaType string) *Link {
+	links := jrd.GetLinksByType(mediaType)
+	if len(links) == 0 {
+		return nil
+	}
+	return links[0]
+}
+
+// GetLinksByType returns all links with the specified media type, in document
+// order.  Media types are compared case-insensitively.  An empty slice is
+// returned if no links match.
+func (jrd *JRD) GetLinksByType(mediaType string) []*Link {
+	links := []*Link{}
+	for i := range jrd.Links {
+		if strings.EqualFold(jrd.Links[i].Type, mediaType) {
+			links = append(links, &jrd.Links[i])
+		}
+	}
+	return links
 }
 
 // GetProperty Returns the property value as a string.
@@ -58,6 +538,13 @@ func (jrd *JRD) GetProperty(uri string) string {
 	return jrd.Properties[uri].(string)
 }
 
+// GetPropertyOK returns the value of the property uri.  present reports
+// whether the property is set, and isNull whether its value is null.  Unlike
+// GetProperty, this distinguishes a null property from a missing one.
+func (jrd *JRD) GetPropertyOK(uri string) (value string, present bool, isNull bool) {
+	return propertyOK(jrd.Properties, uri)
+}
+
 // GetProperty Returns the property value as a string.
 // Per spec a property value can be null, empty string is returned in this case.
 func (link *Link) GetProperty(uri string) string {
@@ -66,3 +553,114 @@ func (link *Link) GetProperty(uri string) string {
 	}
 	return link.Properties[uri].(string)
 }
+
+// GetPropertyOK returns the value of the link property uri.  present reports
+// whether the property is set, and isNull whether its value is null.
+func (link *Link) GetPropertyOK(uri string) (value string, present bool, isNull bool) {
+	return propertyOK(link.Properties, uri)
+}
+
+// PropertiesMap returns the properties of the JRD as a map from property URI
+// to value.  A null property maps to a nil pointer.
+func (jrd *JRD) PropertiesMap() map[string]*string {
+	return propertiesMap(jrd.Properties)
+}
+
+// PropertiesMap returns the properties of the link as a map from property URI
+// to value.  A null property maps to a nil pointer.
+func (link *Link) PropertiesMap() map[string]*string {
+	return propertiesMap(link.Properties)
+}
+
+// propertiesMap converts props to a map of string pointers, with nil for
+// null values.
+func propertiesMap(props map[string]interface{}) map[string]*string {
+	m := make(map[string]*string, len(props))
+	for uri, v := range props {
+		if v == nil {
+			m[uri] = nil
+			continue
+		}
+		value, _ := v.(string)
+		m[uri] = &value
+	}
+	return m
+}
+
+// propertyOK looks up uri in props, reporting whether it is present and
+// whether its value is null.
+func propertyOK(props map[string]interface{}, uri string) (value string, present bool, isNull bool) {
+	v, present := props[uri]
+	if !present {
+		return "", false, false
+	}
+	if v == nil {
+		return "", true, true
+	}
+	value, _ = v.(string)
+	return value, true, false
+}
+
+// GetTitle returns the title of the link best matching the provided language
+// tags, in order of preference.  A tag matches a title with the same language
+// tag, or one that shares its primary language (so "en" matches "en-us").
+// If no title matches, the "default" title is returned, or an empty string if
+// there is no default.
+func (link *Link) GetTitle(langs ...string) string {
+	keys := make([]string, 0, len(link.Titles))
+	for k := range link.Titles {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, lang := range langs {
+		for _, k := range keys {
+			if strings.EqualFold(k, lang) {
+				return link.Titles[k]
+			}
+		}
+		primary := strings.SplitN(lang, "-", 2)[0]
+		for _, k := range keys {
+			if k != "default" && strings.EqualFold(strings.SplitN(k, "-", 2)[0], primary) {
+				return link.Titles[k]
+			}
+		}
+	}
+	return link.Titles["default"]
+}
+
+// ExpandTemplate returns the link's URI template with each {uri} variable
+// replaced by resource.  The resource is percent-encoded following the
+// simple string expansion rules of RFC 6570.  An error is returned if the
+// link has no template.
+func (link *Link) ExpandTemplate(resource string) (string, error) {
+	if link.Template == "" {
+		return "", errors.New("link has no template")
+	}
+	return strings.Replace(link.Template, "{uri}", escapeTemplateValue(resource), -1), nil
+}
+
+// ResolvedHref returns the link's href resolved against base, so a relative
+// href such as "/avatar.png" becomes an absolute URL.  Absolute hrefs are
+// returned unchanged.  An error is returned if the link has no href or either
+// URL cannot be parsed.
+func (link *Link) ResolvedHref(base string) (string, error) {
+	if link.Href == "" {
+		return "", errors.New("link has no href")
+	}
+	ref, err := url.Parse(link.Href)
+	if err != nil {
+		return "", err
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(ref).String(), nil
+}
+
+// escapeTemplateValue percent-encodes all but the unreserved characters of s,
+// as required for RFC 6570 simple string expansion.
+func escapeTemplateValue(s string) string {
+	return percentEncode(s, "-._~")
+}
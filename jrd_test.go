@@ -1,15 +1,17 @@
 package webfinger
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
 
-func TestParseJRD(t *testing.T) {
-	// Example JRD from http://tools.ietf.org/html/rfc6415#appendix-A
-	blob := `
+// Example JRD from http://tools.ietf.org/html/rfc6415#appendix-A
+const rfc6415JRD = `
     {
       "subject":"http://blog.example.com/article/id/314",
       "expires":"2010-01-30T09:30:00Z",
@@ -49,8 +51,10 @@ func TestParseJRD(t *testing.T) {
         }
       ]
     }
-        `
-	obj, err := ParseJRD([]byte(blob))
+`
+
+func TestParseJRD(t *testing.T) {
+	obj, err := ParseJRD([]byte(rfc6415JRD))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -62,6 +66,20 @@ func TestParseJRD(t *testing.T) {
 		t.Errorf("JRD.Expires is %q, want %q", got, want)
 	}
 
+	// Aliases
+	if !obj.HasAlias("http://blog.example.com/cool_new_thing") {
+		t.Error("obj.HasAlias('http://blog.example.com/cool_new_thing') returned false, want true")
+	}
+	if !obj.HasAlias("http://blog.example.com/steve/article/7") {
+		t.Error("obj.HasAlias('http://blog.example.com/steve/article/7') returned false, want true")
+	}
+	if obj.HasAlias("http://blog.example.com/Cool_New_Thing") {
+		t.Error("obj.HasAlias('http://blog.example.com/Cool_New_Thing') returned true, want false")
+	}
+	if obj.HasAlias("http://blog.example.com/article/id/314") {
+		t.Error("obj.HasAlias('http://blog.example.com/article/id/314') returned true, want false")
+	}
+
 	// Properties
 	if got, want := obj.GetProperty("http://blgx.example.net/ns/version"), "1.3"; got != want {
 		t.Errorf("obj.GetProperty('http://blgx.example.net/ns/version') returned %q, want %q", got, want)
@@ -92,6 +110,628 @@ func TestParseJRD(t *testing.T) {
 	if got, want := obj.GetLinkByRel("author").GetProperty("does-not-exist"), ""; got != want {
 		t.Errorf("obj.GetLinkByRel('author').GetProperty('does-not-exist') returned %q, want %q", got, want)
 	}
+
+	copyright, err := obj.GetLinkByRel("copyright").ExpandTemplate("acct:bob@example.com")
+	if err != nil {
+		t.Errorf("obj.GetLinkByRel('copyright').ExpandTemplate returned error: %v", err)
+	}
+	if want := "http://example.com/copyright?id=acct%3Abob%40example.com"; copyright != want {
+		t.Errorf("obj.GetLinkByRel('copyright').ExpandTemplate returned %q, want %q", copyright, want)
+	}
+
+	authors := obj.GetLinksByRel("author")
+	if got, want := len(authors), 2; got != want {
+		t.Fatalf("obj.GetLinksByRel('author') returned %d links, want %d", got, want)
+	}
+	if got, want := authors[0].Href, "http://blog.example.com/author/steve"; got != want {
+		t.Errorf("obj.GetLinksByRel('author')[0].Href is %q, want %q", got, want)
+	}
+	if got, want := authors[1].Href, "http://example.com/author/john"; got != want {
+		t.Errorf("obj.GetLinksByRel('author')[1].Href is %q, want %q", got, want)
+	}
+	if got := obj.GetLinksByRel("does-not-exist"); got == nil || len(got) != 0 {
+		t.Errorf("obj.GetLinksByRel('does-not-exist') returned %#v, want empty slice", got)
+	}
+}
+
+func TestParseJRD_expires(t *testing.T) {
+	want := time.Date(2010, 01, 30, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expires string
+		want    *time.Time
+	}{
+		{`"2010-01-30T09:30:00Z"`, &want},
+		{`"2010-01-30T10:30:00+01:00"`, &want},
+		{`"Sat, 30 Jan 2010 09:30:00 GMT"`, &want},
+		{`"Sat, 30 Jan 2010 09:30:00 +0000"`, &want},
+		{`"2010-01-30T09:30:00"`, &want},
+		{`"2010-01-30 09:30:00Z"`, &want},
+		{`"2010-01-30 09:30:00"`, &want},
+		{`null`, nil},
+		{`"tomorrow"`, nil},
+		{`""`, nil},
+		{`1264843800`, nil},
+	}
+
+	for _, tt := range tests {
+		blob := `{"subject":"acct:bob@example.com","expires":` + tt.expires + `}`
+		jrd, err := ParseJRD([]byte(blob))
+		if err != nil {
+			t.Errorf("ParseJRD with expires %s returned error: %v", tt.expires, err)
+			continue
+		}
+		if jrd.Subject != "acct:bob@example.com" {
+			t.Errorf("ParseJRD with expires %s returned subject %q", tt.expires, jrd.Subject)
+		}
+		if !cmp.Equal(jrd.Expires, tt.want, cmp.Comparer(time.Time.Equal)) {
+			t.Errorf("ParseJRD with expires %s returned expires %v, want %v", tt.expires, jrd.Expires, tt.want)
+		}
+	}
+
+	_, err := ParseAndValidateJRD([]byte(`{"subject":"acct:bob@example.com","expires":"tomorrow"}`))
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("ParseAndValidateJRD with unparseable expires returned %v, want *ValidationError", err)
+	}
+	if want := []string{`expires "tomorrow" is not a valid time`}; !cmp.Equal(verr.Problems, want) {
+		t.Errorf("ValidationError.Problems is %q, want %q", verr.Problems, want)
+	}
+}
+
+func TestJRD_MarshalJSON(t *testing.T) {
+	obj, err := ParseJRD([]byte(rfc6415JRD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("json.Marshal returned error: %v", err)
+	}
+
+	var got, want interface{}
+	if err := json.Unmarshal(blob, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(rfc6415JRD), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("json.Marshal round trip returned diff (-got +want):\n%s", cmp.Diff(got, want))
+	}
+
+	reparsed, err := ParseJRD(blob)
+	if err != nil {
+		t.Fatalf("ParseJRD of marshaled JRD returned error: %v", err)
+	}
+	if !cmp.Equal(reparsed, obj) {
+		t.Errorf("ParseJRD round trip returned diff (-got +want):\n%s", cmp.Diff(reparsed, obj))
+	}
+}
+
+func TestJRD_MarshalJSON_empty(t *testing.T) {
+	expires := time.Date(2010, 01, 30, 10, 30, 0, 0, time.FixedZone("CET", 3600))
+	tests := []struct {
+		jrd  *JRD
+		want string
+	}{
+		{&JRD{}, `{}`},
+		{&JRD{Aliases: []string{}, Properties: map[string]interface{}{}, Links: []Link{}}, `{}`},
+		{&JRD{Expires: &expires}, `{"expires":"2010-01-30T09:30:00Z"}`},
+		{&JRD{Links: []Link{{Rel: "a", Titles: map[string]string{}}}}, `{"links":[{"rel":"a"}]}`},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(tt.jrd)
+		if err != nil {
+			t.Fatalf("json.Marshal returned error: %v", err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("json.Marshal(%#v) returned %s, want %s", tt.jrd, got, tt.want)
+		}
+	}
+}
+
+func TestJRD_Rels(t *testing.T) {
+	obj, err := ParseJRD([]byte(rfc6415JRD))
+	if err != nil {
+		t.Fatalf("ParseJRD returned error: %v", err)
+	}
+	if got, want := obj.Rels(), []string{"author", "copyright"}; !cmp.Equal(got, want) {
+		t.Errorf("Rels returned %q, want %q", got, want)
+	}
+	if got := (&JRD{}).Rels(); got == nil || len(got) != 0 {
+		t.Errorf("Rels with no links returned %#v, want empty slice", got)
+	}
+}
+
+func TestJRD_SelectRels(t *testing.T) {
+	obj, err := ParseJRD([]byte(rfc6415JRD))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rels      []string
+		wantLinks []string
+	}{
+		{nil, []string{"author", "author", "copyright"}},
+		{[]string{"copyright"}, []string{"copyright"}},
+		{[]string{"copyright", "author"}, []string{"author", "author", "copyright"}},
+		{[]string{"author", "does-not-exist"}, []string{"author", "author"}},
+		{[]string{"does-not-exist"}, nil},
+	}
+	for _, tt := range tests {
+		got := obj.SelectRels(tt.rels)
+		var rels []string
+		for _, link := range got.Links {
+			rels = append(rels, link.Rel)
+		}
+		if !cmp.Equal(rels, tt.wantLinks) {
+			t.Errorf("SelectRels(%q) returned links with rels %q, want %q", tt.rels, rels, tt.wantLinks)
+		}
+		if got.Subject != obj.Subject || !cmp.Equal(got.Aliases, obj.Aliases) || !cmp.Equal(got.Properties, obj.Properties) {
+			t.Errorf("SelectRels(%q) did not preserve subject, aliases and properties", tt.rels)
+		}
+	}
+	if got := len(obj.Links); got != 3 {
+		t.Errorf("SelectRels modified the original JRD, which now has %d links", got)
+	}
+}
+
+func TestJRD_Merge(t *testing.T) {
+	soon := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := soon.Add(time.Hour)
+
+	a := &JRD{
+		Subject:    "acct:bob@example.com",
+		Expires:    &later,
+		Aliases:    []string{"https://example.com/@bob"},
+		Properties: map[string]interface{}{"http://example.com/ns/name": "Bob", "http://example.com/ns/age": "40"},
+		Links: []Link{
+			{Rel: "self", Type: "application/activity+json", Href: "https://example.com/users/bob"},
+			{Rel: "http://ostatus.org/schema/1.0/subscribe", Template: "https://example.com/follow?uri={uri}"},
+		},
+	}
+	b := &JRD{
+		Subject:    "https://example.com/users/bob",
+		Expires:    &soon,
+		Aliases:    []string{"acct:bob@example.com"},
+		Properties: map[string]interface{}{"http://example.com/ns/age": "41"},
+		Links: []Link{
+			{Rel: "self", Type: "application/activity+json", Href: "https://example.com/users/bob"},
+			{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/bob.png"},
+			{Rel: "http://ostatus.org/schema/1.0/subscribe", Template: "https://example.com/follow?uri={uri}"},
+		},
+	}
+
+	want := &JRD{
+		Subject:    "acct:bob@example.com",
+		Expires:    &soon,
+		Aliases:    []string{"https://example.com/@bob"},
+		Properties: map[string]interface{}{"http://example.com/ns/name": "Bob", "http://example.com/ns/age": "41"},
+		Links: []Link{
+			{Rel: "self", Type: "application/activity+json", Href: "https://example.com/users/bob"},
+			{Rel: "http://ostatus.org/schema/1.0/subscribe", Template: "https://example.com/follow?uri={uri}"},
+			{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/bob.png"},
+		},
+	}
+	if got := a.Merge(b); !cmp.Equal(got, want) {
+		t.Errorf("Merge returned %#v, want %#v", got, want)
+	}
+	if len(a.Links) != 2 || a.Properties["http://example.com/ns/age"] != "40" || a.Expires != &later {
+		t.Errorf("Merge modified its receiver: %#v", a)
+	}
+
+	if got := a.Merge(nil); !cmp.Equal(got, a) {
+		t.Errorf("Merge(nil) returned %#v, want %#v", got, a)
+	}
+}
+
+func TestJRD_Clone(t *testing.T) {
+	obj, err := ParseJRD([]byte(rfc6415JRD))
+	if err != nil {
+		t.Fatalf("ParseJRD returned error: %v", err)
+	}
+	orig, _ := ParseJRD([]byte(rfc6415JRD))
+
+	clone := obj.Clone()
+	if !cmp.Equal(clone, obj) {
+		t.Errorf("Clone returned %#v, want %#v", clone, obj)
+	}
+
+	*clone.Expires = clone.Expires.Add(time.Hour)
+	clone.Aliases[0] = "changed"
+	clone.Properties["http://blgx.example.net/ns/version"] = "2.0"
+	clone.Links[0].Href = "changed"
+	clone.Links[0].Titles["default"] = "changed"
+	clone.Links[0].Properties["http://example.com/role"] = "changed"
+	if !cmp.Equal(obj, orig) {
+		t.Errorf("Modifying clone changed original to %#v, want %#v", obj, orig)
+	}
+
+	if got := (&JRD{}).Clone(); !cmp.Equal(got, &JRD{}) {
+		t.Errorf("Clone of empty JRD returned %#v, want empty JRD", got)
+	}
+}
+
+func TestJRD_GetLinksByType(t *testing.T) {
+	jrd := &JRD{
+		Links: []Link{
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: "https://example.com/@bob"},
+			{Rel: "self", Type: "application/activity+json", Href: "https://example.com/users/bob"},
+			{Rel: "http://webfinger.net/rel/avatar", Type: "image/png", Href: "https://example.com/bob.png"},
+			{Rel: "alternate", Type: "Text/HTML", Href: "https://example.com/bob"},
+		},
+	}
+
+	if got, want := jrd.GetLinkByType("application/activity+json").Href, "https://example.com/users/bob"; got != want {
+		t.Errorf("GetLinkByType('application/activity+json').Href is %q, want %q", got, want)
+	}
+	if got, want := jrd.GetLinkByType("IMAGE/PNG").Href, "https://example.com/bob.png"; got != want {
+		t.Errorf("GetLinkByType('IMAGE/PNG').Href is %q, want %q", got, want)
+	}
+	if got := jrd.GetLinkByType("application/json"); got != nil {
+		t.Errorf("GetLinkByType('application/json') returned %#v, want nil", got)
+	}
+
+	html := jrd.GetLinksByType("text/html")
+	var got []string
+	for _, link := range html {
+		got = append(got, link.Href)
+	}
+	want := []string{"https://example.com/@bob", "https://example.com/bob"}
+	if !cmp.Equal(got, want) {
+		t.Errorf("GetLinksByType('text/html') returned hrefs %q, want %q", got, want)
+	}
+	if got := jrd.GetLinksByType("application/json"); got == nil || len(got) != 0 {
+		t.Errorf("GetLinksByType('application/json') returned %#v, want empty slice", got)
+	}
+}
+
+func TestJRD_GetPropertyOK(t *testing.T) {
+	obj, err := ParseJRD([]byte(rfc6415JRD))
+	if err != nil {
+		t.Fatalf("ParseJRD returned error: %v", err)
+	}
+
+	tests := []struct {
+		uri         string
+		wantValue   string
+		wantPresent bool
+		wantNull    bool
+	}{
+		{"http://blgx.example.net/ns/version", "1.3", true, false},
+		{"http://blgx.example.net/ns/ext", "", true, true},
+		{"does-not-exist", "", false, false},
+	}
+
+	for _, tt := range tests {
+		value, present, isNull := obj.GetPropertyOK(tt.uri)
+		if value != tt.wantValue || present != tt.wantPresent || isNull != tt.wantNull {
+			t.Errorf("GetPropertyOK(%q) returned %q, %v, %v, want %q, %v, %v", tt.uri, value, present, isNull, tt.wantValue, tt.wantPresent, tt.wantNull)
+		}
+	}
+}
+
+func TestJRD_PropertiesMap(t *testing.T) {
+	obj, err := ParseJRD([]byte(rfc6415JRD))
+	if err != nil {
+		t.Fatalf("ParseJRD returned error: %v", err)
+	}
+
+	version := "1.3"
+	want := map[string]*string{
+		"http://blgx.example.net/ns/version": &version,
+		"http://blgx.example.net/ns/ext":     nil,
+	}
+	if got := obj.PropertiesMap(); !cmp.Equal(got, want) {
+		t.Errorf("PropertiesMap returned %v, want %v", got, want)
+	}
+
+	role := "editor"
+	wantLink := map[string]*string{"http://example.com/role": &role}
+	if got := obj.Links[0].PropertiesMap(); !cmp.Equal(got, wantLink) {
+		t.Errorf("Link.PropertiesMap returned %v, want %v", got, wantLink)
+	}
+	if got := obj.Links[1].PropertiesMap(); got == nil || len(got) != 0 {
+		t.Errorf("Link.PropertiesMap with no properties returned %#v, want empty map", got)
+	}
+}
+
+func TestJRD_IsExpired(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		expires *time.Time
+		want    bool
+	}{
+		{nil, false},
+		{&past, true},
+		{&future, false},
+	}
+	for _, tt := range tests {
+		jrd := &JRD{Expires: tt.expires}
+		if got := jrd.IsExpiredAt(now); got != tt.want {
+			t.Errorf("IsExpiredAt(%v) with expires %v returned %v, want %v", now, tt.expires, got, tt.want)
+		}
+	}
+
+	if (&JRD{}).IsExpired() {
+		t.Error("IsExpired with nil expires returned true")
+	}
+	if !(&JRD{Expires: &past}).IsExpired() {
+		t.Error("IsExpired with past expires returned false")
+	}
+}
+
+func TestLink_GetPropertyOK(t *testing.T) {
+	obj, err := ParseJRD([]byte(rfc6415JRD))
+	if err != nil {
+		t.Fatalf("ParseJRD returned error: %v", err)
+	}
+	author := obj.GetLinkByRel("author")
+
+	tests := []struct {
+		uri         string
+		wantValue   string
+		wantPresent bool
+		wantNull    bool
+	}{
+		{"http://example.com/role", "editor", true, false},
+		{"does-not-exist", "", false, false},
+	}
+
+	for _, tt := range tests {
+		value, present, isNull := author.GetPropertyOK(tt.uri)
+		if value != tt.wantValue || present != tt.wantPresent || isNull != tt.wantNull {
+			t.Errorf("author.GetPropertyOK(%q) returned %q, %v, %v, want %q, %v, %v", tt.uri, value, present, isNull, tt.wantValue, tt.wantPresent, tt.wantNull)
+		}
+	}
+
+	link := &Link{Properties: map[string]interface{}{"http://example.com/null": nil}}
+	if value, present, isNull := link.GetPropertyOK("http://example.com/null"); value != "" || !present || !isNull {
+		t.Errorf("GetPropertyOK of null property returned %q, %v, %v, want \"\", true, true", value, present, isNull)
+	}
+}
+
+func TestLink_GetTitle(t *testing.T) {
+	link := &Link{
+		Titles: map[string]string{
+			"default": "About the Author",
+			"en-us":   "Author Information",
+		},
+	}
+
+	tests := []struct {
+		langs []string
+		want  string
+	}{
+		{nil, "About the Author"},
+		{[]string{"en-us"}, "Author Information"},
+		{[]string{"EN-US"}, "Author Information"},
+		{[]string{"en"}, "Author Information"},
+		{[]string{"en-gb"}, "Author Information"},
+		{[]string{"fr"}, "About the Author"},
+		{[]string{"fr", "en"}, "Author Information"},
+	}
+	for _, tt := range tests {
+		if got := link.GetTitle(tt.langs...); got != tt.want {
+			t.Errorf("GetTitle(%q) returned %q, want %q", tt.langs, got, tt.want)
+		}
+	}
+
+	if got := (&Link{Titles: map[string]string{"de": "Autor"}}).GetTitle("fr"); got != "" {
+		t.Errorf("GetTitle('fr') with no default returned %q, want empty string", got)
+	}
+}
+
+func TestLink_ExpandTemplate(t *testing.T) {
+	link := &Link{Template: "https://example.com/{uri}/lookup?uri={uri}"}
+	got, err := link.ExpandTemplate("http://example.com/a b~c")
+	if err != nil {
+		t.Fatalf("ExpandTemplate returned error: %v", err)
+	}
+	want := "https://example.com/http%3A%2F%2Fexample.com%2Fa%20b~c/lookup?uri=http%3A%2F%2Fexample.com%2Fa%20b~c"
+	if got != want {
+		t.Errorf("ExpandTemplate returned %q, want %q", got, want)
+	}
+
+	if _, err := (&Link{Href: "https://example.com/"}).ExpandTemplate("acct:bob@example.com"); err == nil {
+		t.Error("ExpandTemplate on link without template did not return expected error")
+	}
+}
+
+func TestLink_ResolvedHref(t *testing.T) {
+	tests := []struct {
+		href string
+		base string
+		want string
+	}{
+		{"https://cdn.example.com/bob.png", "https://example.com/users/bob", "https://cdn.example.com/bob.png"},
+		{"/avatar.png", "https://example.com/users/bob", "https://example.com/avatar.png"},
+		{"avatar.png", "https://example.com/users/bob", "https://example.com/users/avatar.png"},
+		{"../avatar.png", "https://example.com/users/bob/", "https://example.com/users/avatar.png"},
+		{"//cdn.example.com/bob.png", "https://example.com/", "https://cdn.example.com/bob.png"},
+	}
+
+	for _, tt := range tests {
+		got, err := (&Link{Href: tt.href}).ResolvedHref(tt.base)
+		if err != nil {
+			t.Errorf("ResolvedHref(%q) of %q returned error: %v", tt.base, tt.href, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolvedHref(%q) of %q returned %q, want %q", tt.base, tt.href, got, tt.want)
+		}
+	}
+
+	if _, err := (&Link{Template: "https://example.com/{uri}"}).ResolvedHref("https://example.com/"); err == nil {
+		t.Error("ResolvedHref on link without href did not return expected error")
+	}
+	if _, err := (&Link{Href: "/avatar.png"}).ResolvedHref("%"); err == nil {
+		t.Error("ResolvedHref with invalid base did not return expected error")
+	}
+}
+
+func TestParseJRD_invalidLink(t *testing.T) {
+	blob := []byte(`{
+  "subject": "acct:bob@example.com",
+  "links": [
+    {"rel": "self", "href": "https://example.com/users/bob"},
+    "https://example.com/bob.png",
+    42,
+    {"rel": "http://webfinger.net/rel/avatar", "href": "https://example.com/bob.png"}
+  ]
+}`)
+
+	_, err := ParseJRD(blob)
+	if err == nil {
+		t.Fatal("ParseJRD with invalid link did not return expected error")
+	}
+	if !strings.Contains(err.Error(), "index 1") {
+		t.Errorf("ParseJRD returned error %q, want one naming index 1", err)
+	}
+
+	jrd, err := ParseJRDLenient(blob)
+	if err != nil {
+		t.Fatalf("ParseJRDLenient returned error: %v", err)
+	}
+	want := []Link{
+		{Rel: "self", Href: "https://example.com/users/bob"},
+		{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/bob.png"},
+	}
+	if !cmp.Equal(jrd.Links, want) {
+		t.Errorf("ParseJRDLenient returned links %#v, want %#v", jrd.Links, want)
+	}
+
+	if _, err := ParseJRDLenient([]byte(`{"links": "self"}`)); err == nil {
+		t.Error("ParseJRDLenient with non-array links did not return expected error")
+	}
+}
+
+func TestParseJRDStrict(t *testing.T) {
+	if _, err := ParseJRDStrict([]byte(rfc6415JRD)); err != nil {
+		t.Errorf("ParseJRDStrict returned error for valid JRD: %v", err)
+	}
+
+	for _, blob := range []string{
+		`{"subject":"acct:bob@example.com","alias":["https://example.com/@bob"]}`,
+		`{"subject":"acct:bob@example.com","links":[{"rel":"self","hreff":"https://example.com/bob"}]}`,
+		`{"subject":"acct:bob@example.com"} {}`,
+		`{"subject":"acct:bob@example.com"} }`,
+		`{"subject":"acct:bob@example.com"}]`,
+	} {
+		if _, err := ParseJRDStrict([]byte(blob)); err == nil {
+			t.Errorf("ParseJRDStrict(%s) did not return expected error", blob)
+		}
+	}
+
+	if _, err := ParseJRD([]byte(`{"subject":"acct:bob@example.com","alias":[]}`)); err != nil {
+		t.Errorf("ParseJRD returned error for unknown field: %v", err)
+	}
+}
+
+func TestParseJRDReader(t *testing.T) {
+	want, err := ParseJRD([]byte(rfc6415JRD))
+	if err != nil {
+		t.Fatalf("ParseJRD returned error: %v", err)
+	}
+	got, err := ParseJRDReader(strings.NewReader(rfc6415JRD))
+	if err != nil {
+		t.Fatalf("ParseJRDReader returned error: %v", err)
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("ParseJRDReader returned %#v, want %#v", got, want)
+	}
+
+	for _, blob := range []string{`{}`, `{"links":null}`, `{"links":[]}`, `{"Subject":"acct:bob@example.com","unknown":{"a":[1]}}`, `{"expires":"Sat, 30 Jan 2010 09:30:00 GMT"}`, `{"expires":"tomorrow"}`} {
+		want, err := ParseJRD([]byte(blob))
+		if err != nil {
+			t.Fatalf("ParseJRD(%s) returned error: %v", blob, err)
+		}
+		got, err := ParseJRDReader(strings.NewReader(blob))
+		if err != nil {
+			t.Errorf("ParseJRDReader(%s) returned error: %v", blob, err)
+		} else if !cmp.Equal(got, want) {
+			t.Errorf("ParseJRDReader(%s) returned %#v, want %#v", blob, got, want)
+		}
+	}
+}
+
+func TestParseJRDReader_large(t *testing.T) {
+	const n = 10000
+	var b strings.Builder
+	b.WriteString(`{"subject":"acct:bob@example.com","links":[`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `{"rel":"http://example.com/rel/%d","href":"https://example.com/%d"}`, i, i)
+	}
+	b.WriteString(`]}`)
+
+	jrd, err := ParseJRDReader(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("ParseJRDReader returned error: %v", err)
+	}
+	if len(jrd.Links) != n {
+		t.Fatalf("ParseJRDReader returned %d links, want %d", len(jrd.Links), n)
+	}
+	if got, want := jrd.Links[n-1], (Link{Rel: fmt.Sprintf("http://example.com/rel/%d", n-1), Href: fmt.Sprintf("https://example.com/%d", n-1)}); !cmp.Equal(got, want) {
+		t.Errorf("ParseJRDReader returned last link %#v, want %#v", got, want)
+	}
+}
+
+func TestParseJRDReader_error(t *testing.T) {
+	for _, blob := range []string{
+		``,
+		`[]`,
+		`{"subject":"acct:bob@example.com"`,
+		`{"links":"self"}`,
+		`{"links":[{"rel":"self"},"bogus"]}`,
+		`{"subject":"acct:bob@example.com"} {}`,
+	} {
+		if _, err := ParseJRDReader(strings.NewReader(blob)); err == nil {
+			t.Errorf("ParseJRDReader(%s) did not return expected error", blob)
+		}
+	}
+
+	_, err := ParseJRDReader(strings.NewReader(`{"links":[{"rel":"self"},"bogus"]}`))
+	if err == nil || !strings.Contains(err.Error(), "index 1") {
+		t.Errorf("ParseJRDReader with invalid link returned %v, want error naming index 1", err)
+	}
+}
+
+func TestParseAndValidateJRD(t *testing.T) {
+	if _, err := ParseAndValidateJRD([]byte(`{"subject":"acct:bob@example.com","links":[{"rel":"a","href":"https://example.com/"}]}`)); err != nil {
+		t.Errorf("ParseAndValidateJRD returned unexpected error: %v", err)
+	}
+
+	blob := []byte(`{"links":[{"rel":"a","href":"https://example.com/","template":"https://example.com/{uri}"}]}`)
+	if _, err := ParseJRD(blob); err != nil {
+		t.Errorf("ParseJRD returned unexpected error: %v", err)
+	}
+	_, err := ParseAndValidateJRD(blob)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("ParseAndValidateJRD returned %v, want *ValidationError", err)
+	}
+	if want := []string{"links[0] has both href and template"}; !cmp.Equal(verr.Problems, want) {
+		t.Errorf("ValidationError.Problems is %q, want %q", verr.Problems, want)
+	}
+
+	_, err = ParseAndValidateJRD([]byte(`{"subject":"bob@example.com"}`))
+	if verr, ok := err.(*ValidationError); !ok || !cmp.Equal(verr.Problems, []string{`subject "bob@example.com" is not an absolute URI`}) {
+		t.Errorf("ParseAndValidateJRD with relative subject returned %v, want ValidationError", err)
+	}
+
+	if _, err := ParseAndValidateJRD([]byte(`{"aliases":"not-a-list"}`)); err == nil {
+		t.Error("ParseAndValidateJRD with non-array aliases did not return expected error")
+	}
+	if _, err := ParseAndValidateJRD([]byte(`{"expires":"tomorrow"}`)); err == nil {
+		t.Error("ParseAndValidateJRD with malformed expires did not return expected error")
+	}
 }
 
 func TestParseJRD_error(t *testing.T) {
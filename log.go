@@ -0,0 +1,67 @@
+package webfinger
+
+import (
+	"log"
+)
+
+// LeveledLogger is the interface used by a Client to log its progress.
+// Infof is used for the main steps of a lookup, and Debugf for details such
+// as individual HTTP requests and redirects.
+type LeveledLogger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+}
+
+// StdLogger is a LeveledLogger that writes to a standard library Logger.
+type StdLogger struct {
+	// Logger is the Logger written to.  If nil, the standard logger
+	// returned by log.Default is used.
+	Logger *log.Logger
+
+	// Debug enables logging of debug messages.
+	Debug bool
+}
+
+// Debugf logs a debug message if l.Debug is set.
+func (l *StdLogger) Debugf(format string, v ...interface{}) {
+	if l.Debug {
+		l.logger().Printf(format, v...)
+	}
+}
+
+// Infof logs an informational message.
+func (l *StdLogger) Infof(format string, v ...interface{}) {
+	l.logger().Printf(format, v...)
+}
+
+// logger returns l.Logger, or the standard logger if it is nil.
+func (l *StdLogger) logger() *log.Logger {
+	if l.Logger == nil {
+		return log.Default()
+	}
+	return l.Logger
+}
+
+// logger returns the LeveledLogger used by the client, or nil if logging is
+// disabled.
+func (c *Client) logger() LeveledLogger {
+	if c.Log != nil {
+		return c.Log
+	}
+	if c.Logger != nil {
+		return &StdLogger{Logger: c.Logger, Debug: true}
+	}
+	return nil
+}
+
+func (c *Client) debugf(format string, v ...interface{}) {
+	if l := c.logger(); l != nil {
+		l.Debugf(format, v...)
+	}
+}
+
+func (c *Client) infof(format string, v ...interface{}) {
+	if l := c.logger(); l != nil {
+		l.Infof(format, v...)
+	}
+}
@@ -0,0 +1,149 @@
+package webfinger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// recordingLogger is a LeveledLogger that records the messages logged at each
+// level.
+type recordingLogger struct {
+	debug, info []string
+}
+
+func (l *recordingLogger) Debugf(format string, v ...interface{}) {
+	l.debug = append(l.debug, fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) Infof(format string, v ...interface{}) {
+	l.info = append(l.info, fmt.Sprintf(format, v...))
+}
+
+func TestClient_Log(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	logger := &recordingLogger{}
+	client.Log = logger
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{}`)
+	})
+
+	resource, _ := Parse("acct:bob@" + host)
+	if _, err := client.LookupResource(resource, nil); err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+
+	wantInfo := []string{"Looking up WebFinger data for acct:bob@" + host}
+	if strings.Join(logger.info, "\n") != strings.Join(wantInfo, "\n") {
+		t.Errorf("Info messages are %q, want %q", logger.info, wantInfo)
+	}
+	wantDebug := []string{"GET " + resource.JRDURL(nil).String()}
+	if strings.Join(logger.debug, "\n") != strings.Join(wantDebug, "\n") {
+		t.Errorf("Debug messages are %q, want %q", logger.debug, wantDebug)
+	}
+}
+
+func TestClient_Log_expiresWarning(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	logger := &recordingLogger{}
+	client.Log = logger
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"acct:bob@example.com","expires":"tomorrow"}`)
+	})
+
+	resource, _ := Parse("acct:bob@" + host)
+	jrd, err := client.LookupResource(resource, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if jrd.Expires != nil {
+		t.Errorf("LookupResource returned expires %v, want nil", jrd.Expires)
+	}
+
+	want := "JRD from " + resource.JRDURL(nil).String() + `: expires "tomorrow" is not a valid time`
+	if got := logger.info[len(logger.info)-1]; got != want {
+		t.Errorf("Last info message is %q, want %q", got, want)
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := &StdLogger{Logger: log.New(&buf, "", 0)}
+	l.Debugf("debug %d", 1)
+	l.Infof("info %d", 2)
+	if got, want := buf.String(), "info 2\n"; got != want {
+		t.Errorf("StdLogger without Debug wrote %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	l.Debug = true
+	l.Debugf("debug %d", 1)
+	if got, want := buf.String(), "debug 1\n"; got != want {
+		t.Errorf("StdLogger with Debug wrote %q, want %q", got, want)
+	}
+
+	// the zero value writes to the standard logger
+	defer func(w io.Writer, flags int) {
+		log.SetOutput(w)
+		log.SetFlags(flags)
+	}(log.Writer(), log.Flags())
+	buf.Reset()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	var zero StdLogger
+	zero.Infof("info %d", 3)
+	if got, want := buf.String(), "info 3\n"; got != want {
+		t.Errorf("zero StdLogger wrote %q, want %q", got, want)
+	}
+}
+
+func TestClient_Logger(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	var buf bytes.Buffer
+	client.Logger = log.New(&buf, "", 0)
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{}`)
+	})
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if got := buf.String(); !strings.Contains(got, "Looking up WebFinger data") || !strings.Contains(got, "GET https://") {
+		t.Errorf("Logger output is %q, want lookup and GET lines", got)
+	}
+}
+
+func TestClient_noLogger(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{}`)
+	})
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if got := buf.String(); got != "" {
+		t.Errorf("Client with no logger wrote %q to the global logger, want nothing", got)
+	}
+}
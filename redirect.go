@@ -0,0 +1,95 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrInsecureRedirect is returned (wrapped) when a WebFinger server redirects
+// an HTTPS request to an HTTP URL and the Client's TransportMode is
+// HTTPSOnly.
+var ErrInsecureRedirect = errors.New("insecure redirect")
+
+// ErrTooManyRedirects is returned (wrapped) when a WebFinger request is
+// redirected more times than the Client allows.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// RedirectError is returned (wrapped) when a redirect is rejected by the
+// Client's redirect policy, for example because of a redirect loop.  It
+// records the chain of URLs that were visited.
+type RedirectError struct {
+	// URLs is the chain of URLs visited, starting with the original request
+	// and ending with the rejected redirect target.
+	URLs []string
+
+	// Err is the reason the redirect was rejected, such as
+	// ErrTooManyRedirects or ErrInsecureRedirect.
+	Err error
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("%v (redirected via %s)", e.Err, strings.Join(e.URLs, " -> "))
+}
+
+func (e *RedirectError) Unwrap() error {
+	return e.Err
+}
+
+// defaultMaxRedirects is the number of redirects followed by http.Client.
+const defaultMaxRedirects = 10
+
+// httpClient returns the http.Client used to send requests: a copy of the
+// client's http.Client with its redirect policy and resolver installed.
+func (c *Client) httpClient() *http.Client {
+	hc := *c.client
+	hc.Transport = c.transport()
+	hc.CheckRedirect = c.checkRedirect(c.client.CheckRedirect)
+	return &hc
+}
+
+// checkRedirect returns a CheckRedirect function enforcing the client's
+// redirect policy before deferring to next.  If next is nil, at most
+// defaultMaxRedirects redirects are followed.  Rejected redirects are
+// reported as a *RedirectError.
+func (c *Client) checkRedirect(next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if err := c.redirectPolicy(req, via, next); err != nil {
+			urls := make([]string, 0, len(via)+1)
+			for _, r := range via {
+				urls = append(urls, r.URL.String())
+			}
+			return &RedirectError{URLs: append(urls, req.URL.String()), Err: err}
+		}
+		c.debugf("Following redirect to %s", req.URL)
+		return nil
+	}
+}
+
+// redirectPolicy returns an error if the redirect to req, after the requests
+// in via, is not permitted by the client's redirect policy or by next.
+func (c *Client) redirectPolicy(req *http.Request, via []*http.Request, next func(*http.Request, []*http.Request) error) error {
+	prev := via[len(via)-1]
+	if c.transportMode() == HTTPSOnly && prev.URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("%w from %s to %s", ErrInsecureRedirect, prev.URL, req.URL)
+	}
+	max := c.MaxRedirects
+	if max == 0 && next == nil {
+		max = defaultMaxRedirects
+	}
+	if max < 0 {
+		return fmt.Errorf("%w: redirects are disabled", ErrTooManyRedirects)
+	} else if max > 0 && len(via) > max {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, max)
+	}
+	if c.RedirectGuard != nil {
+		if err := c.RedirectGuard(req, via); err != nil {
+			return err
+		}
+	}
+	if next != nil {
+		return next(req, via)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLookup_insecureRedirect(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	insecure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	}))
+	defer insecure.Close()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, insecure.URL+r.URL.RequestURI(), http.StatusFound)
+	})
+
+	_, err := client.Lookup("acct:bob@"+host, nil)
+	if !errors.Is(err, ErrInsecureRedirect) {
+		t.Errorf("Lookup returned %v, want ErrInsecureRedirect", err)
+	}
+
+	client.AllowHTTP = true
+	jrd, err := client.Lookup("acct:bob@"+host, nil)
+	if err != nil {
+		t.Fatalf("Lookup with AllowHTTP returned unexpected error: %v", err)
+	}
+	if jrd.Subject != "bob@example.com" {
+		t.Errorf("Lookup returned subject %q, want %q", jrd.Subject, "bob@example.com")
+	}
+}
+
+func TestLookup_verifyInsecureResponse(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.AllowHTTP = true
+
+	const body = `{"subject":"bob@example.com"}`
+	insecure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		w.Header().Set("Signature", "valid")
+		fmt.Fprint(w, body)
+	}))
+	defer insecure.Close()
+
+	redirect := false
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if redirect {
+			http.Redirect(w, r, insecure.URL+r.URL.RequestURI(), http.StatusFound)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, body)
+	})
+
+	calls := 0
+	client.VerifyInsecureResponse = func(res *http.Response) error {
+		calls++
+		content, err := ioutil.ReadAll(res.Body)
+		if err != nil || string(content) != body {
+			t.Errorf("VerifyInsecureResponse read body %q, %v, want %q", content, err, body)
+		}
+		if res.Header.Get("Signature") != "valid" {
+			return errors.New("bad signature")
+		}
+		return nil
+	}
+
+	// responses over HTTPS are not verified
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Errorf("Lookup over HTTPS returned unexpected error: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("VerifyInsecureResponse called %d times for HTTPS response, want 0", calls)
+	}
+
+	redirect = true
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Errorf("Lookup with passing verifier returned unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("VerifyInsecureResponse called %d times, want 1", calls)
+	}
+
+	errBadSignature := errors.New("bad signature")
+	client.VerifyInsecureResponse = func(res *http.Response) error { return errBadSignature }
+	if _, err := client.Lookup("acct:bob@"+host, nil); !errors.Is(err, errBadSignature) {
+		t.Errorf("Lookup with failing verifier returned %v, want %v", err, errBadSignature)
+	}
+}
+
+func TestClient_httpClient(t *testing.T) {
+	hc := &http.Client{}
+	client := NewClient(hc)
+	if client.httpClient().CheckRedirect == nil {
+		t.Error("httpClient() did not install CheckRedirect")
+	}
+	if hc.CheckRedirect != nil {
+		t.Error("httpClient() modified the provided http.Client")
+	}
+}
+
+func TestLookup_maxRedirects(t *testing.T) {
+	tests := []struct {
+		maxRedirects int
+		redirects    int
+		wantErr      bool
+	}{
+		{0, 10, false},
+		{0, 11, true},
+		{2, 2, false},
+		{2, 3, true},
+		{-1, 0, false},
+		{-1, 1, true},
+	}
+
+	for _, tt := range tests {
+		client, mux, host, teardown := setup()
+		client.MaxRedirects = tt.maxRedirects
+
+		redirects := tt.redirects
+		mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+			if redirects > 0 {
+				redirects--
+				http.Redirect(w, r, r.URL.RequestURI(), http.StatusFound)
+				return
+			}
+			w.Header().Add("content-type", "application/jrd+json")
+			fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+		})
+
+		_, err := client.Lookup("acct:bob@"+host, nil)
+		if tt.wantErr {
+			if !errors.Is(err, ErrTooManyRedirects) {
+				t.Errorf("MaxRedirects %d with %d redirects: Lookup returned %v, want ErrTooManyRedirects", tt.maxRedirects, tt.redirects, err)
+			}
+		} else if err != nil {
+			t.Errorf("MaxRedirects %d with %d redirects: Lookup returned unexpected error: %v", tt.maxRedirects, tt.redirects, err)
+		}
+		teardown()
+	}
+}
+
+func TestLookup_maxRedirectsInsecure(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.MaxRedirects = 5
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://"+host+r.URL.RequestURI(), http.StatusFound)
+	})
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); !errors.Is(err, ErrInsecureRedirect) {
+		t.Errorf("Lookup returned %v, want ErrInsecureRedirect", err)
+	}
+}
+
+func TestLookup_redirectGuard(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	errInternal := errors.New("redirect to internal host")
+	var guarded []string
+	client.RedirectGuard = func(req *http.Request, via []*http.Request) error {
+		guarded = append(guarded, req.URL.Path)
+		if ip := net.ParseIP(req.URL.Hostname()); ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+			return fmt.Errorf("%w %s", errInternal, req.URL.Host)
+		}
+		return nil
+	}
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://"+host+"/internal", http.StatusFound)
+	})
+	mux.HandleFunc("/internal", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect rejected by RedirectGuard was followed")
+	})
+
+	_, err := client.Lookup("acct:bob@"+host, nil)
+	if !errors.Is(err, errInternal) {
+		t.Errorf("Lookup returned %v, want error from RedirectGuard", err)
+	}
+	var redirectErr *RedirectError
+	if !errors.As(err, &redirectErr) {
+		t.Errorf("Lookup returned %v, want *RedirectError", err)
+	}
+	if want := []string{"/internal"}; !cmp.Equal(guarded, want) {
+		t.Errorf("RedirectGuard called for %q, want %q", guarded, want)
+	}
+}
+
+func TestLookup_redirectGuardAllows(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	calls := 0
+	client.RedirectGuard = func(req *http.Request, via []*http.Request) error {
+		calls++
+		if len(via) != 1 || via[0].URL.Path != "/.well-known/webfinger" {
+			t.Errorf("RedirectGuard called with via %v, want original request", via)
+		}
+		return nil
+	}
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved", http.StatusFound)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Errorf("Lookup returned unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("RedirectGuard called %d times, want 1", calls)
+	}
+}
+
+func TestLookup_redirectLoop(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.MaxRedirects = 3
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.RequestURI(), http.StatusFound)
+	})
+
+	resource, _ := Parse("acct:bob@" + host)
+	_, err := client.LookupResource(resource, nil)
+	var re *RedirectError
+	if !errors.As(err, &re) {
+		t.Fatalf("Lookup returned %v, want *RedirectError", err)
+	}
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("Lookup returned %v, want ErrTooManyRedirects", err)
+	}
+	u := resource.JRDURL(nil).String()
+	if want := []string{u, u, u, u, u}; !cmp.Equal(re.URLs, want) {
+		t.Errorf("RedirectError.URLs is %q, want %q", re.URLs, want)
+	}
+}
@@ -0,0 +1,136 @@
+package webfinger
+
+import (
+	"mime"
+	"strings"
+)
+
+// Link relations commonly requested in WebFinger queries.
+const (
+	// OIDCIssuerRel is the link relation of an OpenID Connect issuer, as
+	// defined by OpenID Connect Discovery 1.0.
+	OIDCIssuerRel = "http://openid.net/specs/connect/1.0/issuer"
+
+	// OpenIDProviderRel is the link relation of an OpenID 2.0 provider.
+	OpenIDProviderRel = "http://specs.openid.net/auth/2.0/provider"
+
+	// AvatarRel is the link relation of an image representing the resource.
+	AvatarRel = "http://webfinger.net/rel/avatar"
+
+	// ProfilePageRel is the link relation of a human-readable page about the
+	// resource.
+	ProfilePageRel = "http://webfinger.net/rel/profile-page"
+
+	// SelfRel is the link relation of the resource itself, as used by
+	// ActivityPub servers to link an account to its actor document.
+	SelfRel = "self"
+
+	// AuthorRel is the link relation of the resource's author, as defined in
+	// the IANA link relations registry.
+	AuthorRel = "author"
+
+	// CopyrightRel is the link relation of the resource's copyright
+	// statement, as defined in the IANA link relations registry.
+	CopyrightRel = "copyright"
+)
+
+// ianaRelBase is the base URI of registered link relation types, as defined in
+// RFC 5988 section 4.2.
+const ianaRelBase = "http://www.iana.org/assignments/relation/"
+
+// IsRegisteredRel reports whether the link's rel is a registered relation
+// type such as "author", rather than an extension relation type URI.  Per RFC
+// 8288 section 2.1.1, a registered relation type is a token starting with a
+// letter and containing only letters, digits, "." and "-".  Whether the type
+// is actually in the IANA registry is not checked.
+func (link *Link) IsRegisteredRel() bool {
+	if link.Rel == "" {
+		return false
+	}
+	for i, c := range link.Rel {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '.' || c == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RelURI returns the link's rel as a URI.  Registered relation types are
+// converted to URIs under the IANA relation registry, so "author" becomes
+// "http://www.iana.org/assignments/relation/author"; other rels are returned
+// unchanged.
+func (link *Link) RelURI() string {
+	if link.IsRegisteredRel() {
+		return ianaRelBase + strings.ToLower(link.Rel)
+	}
+	return link.Rel
+}
+
+// Media types of ActivityPub actor documents.
+const (
+	activityJSONMediaType  = "application/activity+json"
+	ldJSONMediaType        = "application/ld+json"
+	activityStreamsProfile = "https://www.w3.org/ns/activitystreams"
+)
+
+// ActivityPubActor returns the URL of the ActivityPub actor described by the
+// JRD: the href of its "self" link with type application/activity+json, or
+// application/ld+json with the ActivityStreams profile.  The boolean result
+// reports whether such a link was found.
+func (jrd *JRD) ActivityPubActor() (string, bool) {
+	for _, link := range jrd.GetLinksByRel(SelfRel) {
+		if link.Href != "" && isActivityPubType(link.Type) {
+			return link.Href, true
+		}
+	}
+	return "", false
+}
+
+// isActivityPubType reports whether t is the media type of an ActivityPub
+// actor document.
+func isActivityPubType(t string) bool {
+	mediaType, params, err := mime.ParseMediaType(t)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case activityJSONMediaType:
+		return true
+	case ldJSONMediaType:
+		for _, profile := range strings.Fields(params["profile"]) {
+			if profile == activityStreamsProfile {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OIDCIssuer returns the OpenID Connect issuer location described by the JRD:
+// the href of its OIDCIssuerRel link.  The boolean result reports whether
+// such a link was found.
+func (jrd *JRD) OIDCIssuer() (string, bool) {
+	for _, link := range jrd.GetLinksByRel(OIDCIssuerRel) {
+		if link.Href != "" {
+			return link.Href, true
+		}
+	}
+	return "", false
+}
+
+// AcctURI returns the acct URI describing the same account as the JRD: its
+// subject if that is an acct URI, or otherwise its first acct alias.  The
+// boolean result reports whether such a URI was found.
+func (jrd *JRD) AcctURI() (string, bool) {
+	for _, id := range append([]string{jrd.Subject}, jrd.Aliases...) {
+		if r, err := Parse(id); err == nil && r.Scheme == "acct" {
+			if _, _, ok := r.Account(); ok {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
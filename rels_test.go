@@ -0,0 +1,179 @@
+package webfinger
+
+import "testing"
+
+// mastodonJRD is a WebFinger response as returned by Mastodon.
+const mastodonJRD = `{
+  "subject": "acct:bob@mastodon.example",
+  "aliases": [
+    "https://mastodon.example/@bob",
+    "https://mastodon.example/users/bob"
+  ],
+  "links": [
+    {
+      "rel": "http://webfinger.net/rel/profile-page",
+      "type": "text/html",
+      "href": "https://mastodon.example/@bob"
+    },
+    {
+      "rel": "self",
+      "type": "application/activity+json",
+      "href": "https://mastodon.example/users/bob"
+    },
+    {
+      "rel": "http://ostatus.org/schema/1.0/subscribe",
+      "template": "https://mastodon.example/authorize_interaction?uri={uri}"
+    }
+  ]
+}`
+
+func TestJRD_ActivityPubActor(t *testing.T) {
+	mastodon, err := ParseJRD([]byte(mastodonJRD))
+	if err != nil {
+		t.Fatalf("ParseJRD returned error: %v", err)
+	}
+
+	tests := []struct {
+		description string
+		jrd         *JRD
+		want        string
+		wantOK      bool
+	}{
+		{"mastodon", mastodon, "https://mastodon.example/users/bob", true},
+		{
+			"ld+json with activitystreams profile",
+			&JRD{Links: []Link{{
+				Rel:  "self",
+				Type: `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`,
+				Href: "https://example.com/actor",
+			}}},
+			"https://example.com/actor", true,
+		},
+		{
+			"ld+json without profile",
+			&JRD{Links: []Link{{Rel: "self", Type: "application/ld+json", Href: "https://example.com/actor"}}},
+			"", false,
+		},
+		{
+			"self link of another type",
+			&JRD{Links: []Link{
+				{Rel: "self", Type: "text/html", Href: "https://example.com/bob"},
+				{Rel: "self", Type: "application/activity+json", Href: "https://example.com/actor"},
+			}},
+			"https://example.com/actor", true,
+		},
+		{
+			"activity+json link with another rel",
+			&JRD{Links: []Link{{Rel: "alternate", Type: "application/activity+json", Href: "https://example.com/actor"}}},
+			"", false,
+		},
+		{"no links", &JRD{}, "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := tt.jrd.ActivityPubActor()
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ActivityPubActor(%s) returned %q, %v, want %q, %v", tt.description, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestJRD_OIDCIssuer(t *testing.T) {
+	// example from OpenID Connect Discovery 1.0, section 2.1
+	jrd, err := ParseJRD([]byte(`{
+  "subject": "acct:joe@example.com",
+  "links": [
+    {
+      "rel": "http://openid.net/specs/connect/1.0/issuer",
+      "href": "https://server.example.com"
+    }
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("ParseJRD returned error: %v", err)
+	}
+	if got, ok := jrd.OIDCIssuer(); got != "https://server.example.com" || !ok {
+		t.Errorf("OIDCIssuer returned %q, %v, want %q, true", got, ok, "https://server.example.com")
+	}
+
+	mastodon, _ := ParseJRD([]byte(mastodonJRD))
+	if got, ok := mastodon.OIDCIssuer(); got != "" || ok {
+		t.Errorf("OIDCIssuer without issuer link returned %q, %v, want \"\", false", got, ok)
+	}
+}
+
+func TestJRD_AcctURI(t *testing.T) {
+	tests := []struct {
+		jrd    *JRD
+		want   string
+		wantOK bool
+	}{
+		{&JRD{Subject: "acct:bob@example.com"}, "acct:bob@example.com", true},
+		{&JRD{Subject: "https://example.com/@bob", Aliases: []string{"https://example.com/users/bob", "acct:bob@example.com"}}, "acct:bob@example.com", true},
+		{&JRD{Subject: "https://example.com/@bob", Aliases: []string{"acct:example.com"}}, "", false},
+		{&JRD{Subject: "https://example.com/@bob"}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.jrd.AcctURI()
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("AcctURI() for %#v returned %q, %v, want %q, %v", tt.jrd, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	mastodon, _ := ParseJRD([]byte(mastodonJRD))
+	if got, ok := mastodon.AcctURI(); got != "acct:bob@mastodon.example" || !ok {
+		t.Errorf("AcctURI returned %q, %v, want %q, true", got, ok, "acct:bob@mastodon.example")
+	}
+}
+
+func TestLink_RelURI(t *testing.T) {
+	obj, err := ParseJRD([]byte(rfc6415JRD))
+	if err != nil {
+		t.Fatalf("ParseJRD returned error: %v", err)
+	}
+	if link := obj.Links[0]; !link.IsRegisteredRel() || link.RelURI() != "http://www.iana.org/assignments/relation/author" {
+		t.Errorf("rel %q has IsRegisteredRel %v and RelURI %q, want true and IANA URI", link.Rel, link.IsRegisteredRel(), link.RelURI())
+	}
+
+	tests := []struct {
+		rel            string
+		wantRegistered bool
+		wantURI        string
+	}{
+		{"copyright", true, "http://www.iana.org/assignments/relation/copyright"},
+		{"Author", true, "http://www.iana.org/assignments/relation/author"},
+		{"hub.topic-2", true, "http://www.iana.org/assignments/relation/hub.topic-2"},
+		{"http://webfinger.net/rel/avatar", false, "http://webfinger.net/rel/avatar"},
+		{OIDCIssuerRel, false, OIDCIssuerRel},
+		{"2fa", false, "2fa"},
+		{"", false, ""},
+	}
+	for _, tt := range tests {
+		link := &Link{Rel: tt.rel}
+		if got := link.IsRegisteredRel(); got != tt.wantRegistered {
+			t.Errorf("IsRegisteredRel() for %q returned %v, want %v", tt.rel, got, tt.wantRegistered)
+		}
+		if got := link.RelURI(); got != tt.wantURI {
+			t.Errorf("RelURI() for %q returned %q, want %q", tt.rel, got, tt.wantURI)
+		}
+	}
+}
+
+func TestRelConstants(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{OIDCIssuerRel, "http://openid.net/specs/connect/1.0/issuer"},
+		{OpenIDProviderRel, "http://specs.openid.net/auth/2.0/provider"},
+		{AvatarRel, "http://webfinger.net/rel/avatar"},
+		{ProfilePageRel, "http://webfinger.net/rel/profile-page"},
+		{SelfRel, "self"},
+		{AuthorRel, "author"},
+		{CopyrightRel, "copyright"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("rel constant is %q, want %q", tt.got, tt.want)
+		}
+	}
+}
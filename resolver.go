@@ -0,0 +1,116 @@
+package webfinger
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A DNSResolver looks up DNS records for a Client: the addresses of the hosts
+// it connects to, and SRV records when Client.UseSRV is set.  *net.Resolver
+// implements DNSResolver.  It is unrelated to ResolverFunc, which resolves
+// the JRDs served by a Handler.
+type DNSResolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// dnsResolver returns the client's DNSResolver, or net.DefaultResolver if
+// none is set.
+func (c *Client) dnsResolver() DNSResolver {
+	if c.DNSResolver != nil {
+		return c.DNSResolver
+	}
+	return net.DefaultResolver
+}
+
+// srvHost returns the host and port that WebFinger queries for hostname are
+// delegated to by its _webfinger._tcp SRV record.  An empty string is
+// returned if there is no such record.
+func (c *Client) srvHost(ctx context.Context, hostname string) string {
+	_, addrs, err := c.dnsResolver().LookupSRV(ctx, "webfinger", "tcp", hostname)
+	if err != nil || len(addrs) == 0 {
+		c.debugf("No WebFinger SRV record for %s: %v", hostname, err)
+		return ""
+	}
+	// RFC 2782: a target of "." means the service is not available
+	target := strings.TrimSuffix(addrs[0].Target, ".")
+	if target == "" {
+		return ""
+	}
+	return net.JoinHostPort(target, strconv.Itoa(int(addrs[0].Port)))
+}
+
+// resolvingTransport is a clone of an *http.Transport, base, that resolves
+// host names with the DNSResolver of the Client owner.  The clone is kept so
+// that connections are reused.
+type resolvingTransport struct {
+	mu    sync.Mutex
+	owner *Client
+	base  *http.Transport
+	clone *http.Transport
+}
+
+// transport returns the RoundTripper used to send requests.  If the client
+// has a DNSResolver and its http.Client uses an *http.Transport, that
+// transport is cloned to resolve host names with the DNSResolver.  Copies of
+// a Client share its resolvingTransport, so each copy replaces the clone with
+// its own when it sends a request.
+func (c *Client) transport() http.RoundTripper {
+	base := c.client.Transport
+	if c.DNSResolver == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return base
+	}
+
+	r := c.resolving
+	if r == nil {
+		r = &resolvingTransport{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.owner != c || r.base != t {
+		clone := t.Clone()
+		clone.DialContext = c.dialContext(t.DialContext)
+		r.owner, r.base, r.clone = c, t, clone
+	}
+	return r.clone
+}
+
+// dialContext returns a DialContext function that resolves host names with
+// the client's DNSResolver, falling back to next if it has none.
+func (c *Client) dialContext(next func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if next == nil {
+		next = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if c.DNSResolver == nil || err != nil || net.ParseIP(host) != nil {
+			return next(ctx, network, addr)
+		}
+		addrs, err := c.DNSResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+		for _, a := range addrs {
+			var conn net.Conn
+			conn, err = next(ctx, network, net.JoinHostPort(a, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
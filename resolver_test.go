@@ -0,0 +1,159 @@
+package webfinger
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// fakeResolver is a DNSResolver that answers lookups from maps of names to
+// records, recording the names looked up.
+type fakeResolver struct {
+	hosts   map[string][]string
+	srv     map[string][]*net.SRV
+	lookups []string
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lookups = append(r.lookups, host)
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	qname := "_" + service + "._" + proto + "." + name
+	r.lookups = append(r.lookups, qname)
+	addrs, ok := r.srv[qname]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: qname, IsNotFound: true}
+	}
+	return qname, addrs, nil
+}
+
+func TestLookup_srv(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	hostname, portStr, _ := net.SplitHostPort(host)
+	port, _ := strconv.Atoi(portStr)
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{"subject":%q}`, r.FormValue("resource"))
+	})
+
+	resolver := &fakeResolver{srv: map[string][]*net.SRV{
+		"_webfinger._tcp.example.com": {{Target: hostname + ".", Port: uint16(port)}},
+	}}
+	client.DNSResolver = resolver
+	client.UseSRV = true
+
+	jrd, err := client.Lookup("acct:bob@Example.com", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if got, want := jrd.Subject, "acct:bob@Example.com"; got != want {
+		t.Errorf("Lookup returned subject %q, want %q", got, want)
+	}
+	if want := []string{"_webfinger._tcp.example.com"}; len(resolver.lookups) != 1 || resolver.lookups[0] != want[0] {
+		t.Errorf("DNSResolver looked up %q, want %q", resolver.lookups, want)
+	}
+
+	// without an SRV record, the resource's host is used
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Errorf("Lookup without SRV record returned error: %v", err)
+	}
+
+	// SRV records are ignored unless enabled
+	client.UseSRV = false
+	resolver.lookups = nil
+	if _, err := client.Lookup("acct:bob@"+host, nil); err != nil {
+		t.Errorf("Lookup with UseSRV disabled returned error: %v", err)
+	}
+	if len(resolver.lookups) != 0 {
+		t.Errorf("DNSResolver consulted with UseSRV disabled: %q", resolver.lookups)
+	}
+}
+
+func TestClient_srvHost(t *testing.T) {
+	client := NewClient(nil)
+	client.DNSResolver = &fakeResolver{srv: map[string][]*net.SRV{
+		"_webfinger._tcp.example.com":     {{Target: "wf.example.net.", Port: 8443}, {Target: "backup.example.net.", Port: 443}},
+		"_webfinger._tcp.unavailable.com": {{Target: ".", Port: 0}},
+	}}
+
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{"example.com", "wf.example.net:8443"},
+		{"unavailable.com", ""},
+		{"example.org", ""},
+	}
+	for _, tt := range tests {
+		if got := client.srvHost(context.Background(), tt.hostname); got != tt.want {
+			t.Errorf("srvHost(%q) returned %q, want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
+
+func TestLookup_resolver(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	hostname, port, _ := net.SplitHostPort(host)
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"acct:bob@webfinger.test"}`)
+	})
+
+	resolver := &fakeResolver{hosts: map[string][]string{"webfinger.test": {hostname}}}
+	client.DNSResolver = resolver
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Lookup("acct:bob@webfinger.test:"+port, nil); err != nil {
+			t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+		}
+	}
+	if len(resolver.lookups) == 0 || resolver.lookups[0] != "webfinger.test" {
+		t.Errorf("DNSResolver looked up %q, want %q", resolver.lookups, "webfinger.test")
+	}
+
+	if _, err := client.Lookup("acct:bob@unknown.test:"+port, nil); err == nil {
+		t.Error("Lookup of host unknown to resolver did not return expected error")
+	}
+}
+
+func TestLookup_resolverCopiedClient(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	hostname, port, _ := net.SplitHostPort(host)
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"acct:bob@webfinger.test"}`)
+	})
+
+	resolver := &fakeResolver{hosts: map[string][]string{"webfinger.test": {hostname}}}
+	client.DNSResolver = resolver
+	copied := *client
+	copiedResolver := &fakeResolver{hosts: map[string][]string{"webfinger.test": {hostname}}}
+	copied.DNSResolver = copiedResolver
+
+	for _, c := range []*Client{client, &copied, client} {
+		if _, err := c.Lookup("acct:bob@webfinger.test:"+port, nil); err != nil {
+			t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+		}
+	}
+	if len(resolver.lookups) == 0 {
+		t.Error("DNSResolver of original client was not used")
+	}
+	if len(copiedResolver.lookups) == 0 {
+		t.Error("DNSResolver of copied client was not used")
+	}
+}
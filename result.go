@@ -0,0 +1,67 @@
+package webfinger
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Source identifies where a Client found a JRD.
+type Source int
+
+const (
+	// SourceHTTP indicates that the JRD was fetched with a WebFinger query.
+	SourceHTTP Source = iota
+
+	// SourceCache indicates that the JRD was served from the Client's Cache,
+	// either because it was fresh or because the server confirmed with a 304
+	// Not Modified response that it was unchanged.
+	SourceCache
+
+	// SourceHostMeta indicates that the JRD was found using the legacy
+	// host-meta fallback.
+	SourceHostMeta
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceHTTP:
+		return "HTTP"
+	case SourceCache:
+		return "Cache"
+	case SourceHostMeta:
+		return "HostMeta"
+	}
+	return "Source(" + strconv.Itoa(int(s)) + ")"
+}
+
+// LookupResult is the detailed outcome of a lookup, as returned by
+// Client.LookupResourceDetailed.
+type LookupResult struct {
+	// JRD is the JRD that was found.
+	JRD *JRD
+
+	// Source is where the JRD was found.
+	Source Source
+
+	// URL is the URL the JRD was found at, after any redirects.  For a JRD
+	// served from the cache without revalidation, it is the query URL.
+	URL *url.URL
+}
+
+// LookupResourceDetailed is like LookupResource, but also reports where the
+// JRD was found, for debugging and metrics.
+func (c *Client) LookupResourceDetailed(resource *Resource, rels []string) (*LookupResult, error) {
+	return c.LookupResourceDetailedContext(context.Background(), resource, rels)
+}
+
+// LookupResourceDetailedContext is like LookupResourceDetailed, but the lookup
+// is bound to ctx.  If ctx is cancelled or its deadline expires before the
+// lookup completes, ctx.Err() is returned.
+func (c *Client) LookupResourceDetailedContext(ctx context.Context, resource *Resource, rels []string) (*LookupResult, error) {
+	result, err := c.lookupResult(ctx, resource, "", rels, false)
+	if err != nil {
+		return nil, err
+	}
+	return &LookupResult{JRD: result.jrd, Source: result.source, URL: result.url}, nil
+}
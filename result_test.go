@@ -0,0 +1,108 @@
+package webfinger
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestLookupResourceDetailed(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.Cache = NewMemoryCache()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	resource, _ := Parse("acct:bob@" + host)
+	want := resource.JRDURL(nil).String()
+	for _, wantSource := range []Source{SourceHTTP, SourceCache} {
+		result, err := client.LookupResourceDetailed(resource, nil)
+		if err != nil {
+			t.Fatalf("LookupResourceDetailed returned error: %v", err)
+		}
+		if result.Source != wantSource {
+			t.Errorf("LookupResourceDetailed returned source %v, want %v", result.Source, wantSource)
+		}
+		if got := result.URL.String(); got != want {
+			t.Errorf("LookupResourceDetailed returned URL %q, want %q", got, want)
+		}
+		if result.JRD.Subject != "bob@example.com" {
+			t.Errorf("LookupResourceDetailed returned subject %q, want %q", result.JRD.Subject, "bob@example.com")
+		}
+	}
+}
+
+func TestLookupResourceDetailed_redirect(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved", http.StatusFound)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	resource, _ := Parse("acct:bob@" + host)
+	result, err := client.LookupResourceDetailed(resource, nil)
+	if err != nil {
+		t.Fatalf("LookupResourceDetailed returned error: %v", err)
+	}
+	if result.Source != SourceHTTP {
+		t.Errorf("LookupResourceDetailed returned source %v, want %v", result.Source, SourceHTTP)
+	}
+	if got, want := result.URL.String(), "https://"+host+"/moved"; got != want {
+		t.Errorf("LookupResourceDetailed returned URL %q, want %q", got, want)
+	}
+}
+
+func TestLookupResourceDetailed_hostMeta(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.AllowHostMeta = true
+
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/xrd+xml")
+		fmt.Fprintf(w, `<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+			  <Link rel='lrdd' template='https://%s/lrdd?uri={uri}' />
+			</XRD>`, host)
+	})
+	mux.HandleFunc("/lrdd", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	resource, _ := Parse("acct:bob@" + host)
+	result, err := client.LookupResourceDetailed(resource, nil)
+	if err != nil {
+		t.Fatalf("LookupResourceDetailed returned error: %v", err)
+	}
+	if result.Source != SourceHostMeta {
+		t.Errorf("LookupResourceDetailed returned source %v, want %v", result.Source, SourceHostMeta)
+	}
+	if got, want := result.URL.Path, "/lrdd"; got != want {
+		t.Errorf("LookupResourceDetailed returned URL path %q, want %q", got, want)
+	}
+}
+
+func TestSource_String(t *testing.T) {
+	tests := []struct {
+		source Source
+		want   string
+	}{
+		{SourceHTTP, "HTTP"},
+		{SourceCache, "Cache"},
+		{SourceHostMeta, "HostMeta"},
+		{Source(7), "Source(7)"},
+	}
+	for _, tt := range tests {
+		if got := tt.source.String(); got != tt.want {
+			t.Errorf("String() returned %q, want %q", got, tt.want)
+		}
+	}
+}
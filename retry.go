@@ -0,0 +1,126 @@
+package webfinger
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how a Client retries WebFinger requests that fail
+// with a transient network error, such as a timeout or a reset connection, or
+// a transient HTTP status.  Errors that would recur, such as a rejected
+// redirect or an invalid certificate, are not retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is attempted,
+	// including the first.  Values less than 2 disable retries.
+	MaxAttempts int
+
+	// BaseBackoff is the delay before the first retry.  The delay doubles for
+	// each subsequent retry, up to MaxBackoff.
+	BaseBackoff time.Duration
+
+	// MaxBackoff is the longest delay before a retry.  If a server asks for
+	// a longer delay with a Retry-After header, the request is not retried.
+	// If zero, DefaultMaxBackoff is used.
+	MaxBackoff time.Duration
+
+	// RetryableStatusCodes are the HTTP status codes that cause a request to
+	// be retried.  If nil, DefaultRetryableStatusCodes is used.
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryableStatusCodes are the status codes retried by a RetryPolicy
+// that does not specify its own.
+var DefaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultMaxBackoff is the longest delay before a retry when
+// RetryPolicy.MaxBackoff is not set.
+const DefaultMaxBackoff = 30 * time.Second
+
+// retryable reports whether a response with the given status code should be
+// retried.
+func (p *RetryPolicy) retryable(code int) bool {
+	codes := p.RetryableStatusCodes
+	if codes == nil {
+		codes = DefaultRetryableStatusCodes
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the given retry, counting from 1, capped
+// at the policy's maximum backoff.  If res is a 429 or 503 response with a
+// Retry-After header, the delay it specifies is used instead, and ok is false
+// if that exceeds the maximum.
+func (p *RetryPolicy) backoff(retry int, res *http.Response, now time.Time) (delay time.Duration, ok bool) {
+	max := p.MaxBackoff
+	if max == 0 {
+		max = DefaultMaxBackoff
+	}
+	if res != nil && (res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable) {
+		if d, ok := retryAfter(res.Header.Get("Retry-After"), now); ok {
+			return d, d <= max
+		}
+	}
+	delay = p.BaseBackoff
+	for i := 1; i < retry && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay, true
+}
+
+// transientError reports whether err, returned for a request, may not recur
+// if the request is retried: a timeout, a temporary DNS failure, or a
+// connection that could not be made or was reset or closed.
+func transientError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,202 @@
+package webfinger
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("retryAfter(%q) returned %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := &RetryPolicy{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	now := time.Now()
+	for retry, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		if got, ok := p.backoff(retry+1, &http.Response{StatusCode: 502}, now); got != want || !ok {
+			t.Errorf("backoff(%d) returned %v, %v, want %v, true", retry+1, got, ok, want)
+		}
+	}
+	// the delay is capped rather than overflowing
+	if got, ok := p.backoff(100, nil, now); got != p.MaxBackoff || !ok {
+		t.Errorf("backoff(100) returned %v, %v, want %v, true", got, ok, p.MaxBackoff)
+	}
+
+	res := &http.Response{StatusCode: 429, Header: http.Header{"Retry-After": {"7"}}}
+	if got, ok := p.backoff(1, res, now); got != 7*time.Second || !ok {
+		t.Errorf("backoff with Retry-After returned %v, %v, want %v, true", got, ok, 7*time.Second)
+	}
+	res = &http.Response{StatusCode: 503, Header: http.Header{"Retry-After": {"86400"}}}
+	if _, ok := p.backoff(1, res, now); ok {
+		t.Error("backoff with Retry-After beyond MaxBackoff returned ok")
+	}
+
+	p = &RetryPolicy{BaseBackoff: time.Hour}
+	if got, _ := p.backoff(1, nil, now); got != DefaultMaxBackoff {
+		t.Errorf("backoff with no MaxBackoff returned %v, want %v", got, DefaultMaxBackoff)
+	}
+}
+
+func TestTransientError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: io.EOF}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}}}, false},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &RedirectError{Err: ErrInsecureRedirect}}, false},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}, false},
+		{errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := transientError(tt.err); got != tt.want {
+			t.Errorf("transientError(%#v) returned %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestLookup_retryRedirectRejected(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.RetryPolicy = &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+	client.RedirectGuard = func(req *http.Request, via []*http.Request) error {
+		return errors.New("internal host")
+	}
+
+	requests := 0
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, "https://169.254.169.254/latest/meta-data", http.StatusFound)
+	})
+
+	var redirectErr *RedirectError
+	if _, err := client.Lookup("acct:bob@"+host, nil); !errors.As(err, &redirectErr) {
+		t.Errorf("Lookup returned %v, want *RedirectError", err)
+	}
+	if requests != 1 {
+		t.Errorf("Server received %d requests, want 1", requests)
+	}
+}
+
+func TestLookup_retry(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.RetryPolicy = &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+
+	requests := 0
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	jrd, err := client.Lookup("acct:bob@"+host, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if jrd.Subject != "bob@example.com" {
+		t.Errorf("Lookup returned subject %q, want %q", jrd.Subject, "bob@example.com")
+	}
+	if requests != 3 {
+		t.Errorf("Server received %d requests, want 3", requests)
+	}
+}
+
+func TestLookup_retryMaxAttempts(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.RetryPolicy = &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+
+	requests := 0
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	_, err := client.Lookup("acct:bob@"+host, nil)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Lookup returned %v, want 503 StatusError", err)
+	}
+	if requests != 3 {
+		t.Errorf("Server received %d requests, want 3", requests)
+	}
+}
+
+func TestLookup_retryNotRetryable(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.RetryPolicy = &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+
+	requests := 0
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	if _, err := client.Lookup("acct:bob@"+host, nil); !IsNotFound(err) {
+		t.Errorf("Lookup returned %v, want not found error", err)
+	}
+	if requests != 1 {
+		t.Errorf("Server received %d requests, want 1", requests)
+	}
+}
+
+func TestLookup_retryDeadline(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	client.RetryPolicy = &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Hour}
+
+	requests := 0
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.LookupContext(ctx, "acct:bob@"+host, nil)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Lookup returned %v, want 503 StatusError", err)
+	}
+	if requests != 1 {
+		t.Errorf("Server received %d requests, want 1", requests)
+	}
+}
@@ -0,0 +1,95 @@
+package webfinger
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// allowedMethods are the HTTP methods supported by a Handler.
+const allowedMethods = "GET, HEAD, OPTIONS"
+
+// ResolverFunc returns the JRD for a resource queried on a Handler.  rels are
+// the link relations requested by the client, if any; the Handler removes
+// other links from the returned JRD, so resolvers are free to ignore them.
+// If there is no WebFinger record for the resource, ErrNotFound should be
+// returned; a nil JRD with a nil error is treated the same way.
+type ResolverFunc func(resource *Resource, rels []string) (*JRD, error)
+
+// Handler is an http.Handler that serves WebFinger queries, typically mounted
+// at /.well-known/webfinger.
+type Handler struct {
+	// Resolver returns the JRD for each queried resource.
+	Resolver ResolverFunc
+
+	// AllowOrigin is the value of the Access-Control-Allow-Origin header
+	// sent with every response.  If empty, "*" is used, allowing queries from
+	// any origin as recommended by RFC 7033.
+	AllowOrigin string
+}
+
+// NewHandler returns a Handler that resolves queries using resolver.
+func NewHandler(resolver ResolverFunc) *Handler {
+	return &Handler{Resolver: resolver}
+}
+
+// ServeHTTP responds to a WebFinger query.  It responds with 400 Bad Request
+// if the resource parameter is missing or invalid, and 404 Not Found if the
+// resolver returns ErrNotFound or a nil JRD.  CORS preflight requests are answered
+// directly.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// WebFinger servers must support CORS (RFC 7033 section 5)
+	origin := h.AllowOrigin
+	if origin == "" {
+		origin = "*"
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if origin != "*" {
+		w.Header().Add("Vary", "Origin")
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+		if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	rawResource := query.Get("resource")
+	if rawResource == "" {
+		http.Error(w, "missing resource parameter", http.StatusBadRequest)
+		return
+	}
+	resource, err := Parse(rawResource)
+	if err != nil {
+		http.Error(w, "invalid resource parameter", http.StatusBadRequest)
+		return
+	}
+	rels := query["rel"]
+
+	jrd, err := h.Resolver(resource, rels)
+	if errors.Is(err, ErrNotFound) || (err == nil && jrd == nil) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	body, err := json.Marshal(jrd.SelectRels(rels))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", jrdMediaType)
+	w.Write(body)
+}
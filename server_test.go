@@ -0,0 +1,187 @@
+package webfinger
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testResolver(resource *Resource, rels []string) (*JRD, error) {
+	switch resource.String() {
+	case "acct:bob@example.com":
+		return &JRD{
+			Subject: "acct:bob@example.com",
+			Links: []Link{
+				{Rel: "http://webfinger.net/rel/profile-page", Href: "https://example.com/bob"},
+				{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/bob.png"},
+			},
+		}, nil
+	case "acct:broken@example.com":
+		return nil, errors.New("database unavailable")
+	case "acct:nil@example.com":
+		return nil, nil
+	}
+	return nil, ErrNotFound
+}
+
+func serveQuery(h http.Handler, method string, query url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/.well-known/webfinger?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(testResolver)
+
+	w := serveQuery(h, http.MethodGet, url.Values{"resource": {"acct:bob@example.com"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Handler returned status %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := w.Header().Get("Content-Type"), "application/jrd+json"; got != want {
+		t.Errorf("Handler returned Content-Type %q, want %q", got, want)
+	}
+	if got, want := w.Header().Get("Access-Control-Allow-Origin"), "*"; got != want {
+		t.Errorf("Handler returned Access-Control-Allow-Origin %q, want %q", got, want)
+	}
+	jrd, err := ParseJRD(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Handler returned invalid JRD: %v", err)
+	}
+	want, _ := testResolver(&Resource{Scheme: "acct", Opaque: "bob@example.com"}, nil)
+	if !cmp.Equal(jrd, want) {
+		t.Errorf("Handler returned %#v, want %#v", jrd, want)
+	}
+}
+
+func TestHandler_rel(t *testing.T) {
+	h := NewHandler(testResolver)
+
+	w := serveQuery(h, http.MethodGet, url.Values{
+		"resource": {"acct:bob@example.com"},
+		"rel":      {"http://webfinger.net/rel/avatar"},
+	})
+	jrd, err := ParseJRD(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Handler returned invalid JRD: %v", err)
+	}
+	want := &JRD{
+		Subject: "acct:bob@example.com",
+		Links:   []Link{{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/bob.png"}},
+	}
+	if !cmp.Equal(jrd, want) {
+		t.Errorf("Handler returned %#v, want %#v", jrd, want)
+	}
+}
+
+func TestHandler_multipleRels(t *testing.T) {
+	h := NewHandler(testResolver)
+
+	w := serveQuery(h, http.MethodGet, url.Values{
+		"resource": {"acct:bob@example.com"},
+		"rel":      {"http://webfinger.net/rel/avatar", "http://webfinger.net/rel/profile-page", "http://example.com/rel/none"},
+	})
+	jrd, err := ParseJRD(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Handler returned invalid JRD: %v", err)
+	}
+	if got, want := len(jrd.Links), 2; got != want {
+		t.Errorf("Handler returned %d links, want %d", got, want)
+	}
+
+	w = serveQuery(h, http.MethodGet, url.Values{
+		"resource": {"acct:bob@example.com"},
+		"rel":      {"http://example.com/rel/none"},
+	})
+	jrd, err = ParseJRD(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Handler returned invalid JRD: %v", err)
+	}
+	if want := (&JRD{Subject: "acct:bob@example.com"}); !cmp.Equal(jrd, want) {
+		t.Errorf("Handler returned %#v, want %#v", jrd, want)
+	}
+}
+
+func TestHandler_errors(t *testing.T) {
+	h := NewHandler(testResolver)
+
+	tests := []struct {
+		method string
+		query  url.Values
+		want   int
+	}{
+		{http.MethodGet, url.Values{}, http.StatusBadRequest},
+		{http.MethodGet, url.Values{"resource": {"example.com"}}, http.StatusBadRequest},
+		{http.MethodGet, url.Values{"resource": {"acct:alice@example.com"}}, http.StatusNotFound},
+		{http.MethodGet, url.Values{"resource": {"acct:broken@example.com"}}, http.StatusInternalServerError},
+		{http.MethodGet, url.Values{"resource": {"acct:nil@example.com"}}, http.StatusNotFound},
+		{http.MethodGet, url.Values{"resource": {"acct:nil@example.com"}, "rel": {"self"}}, http.StatusNotFound},
+		{http.MethodPost, url.Values{"resource": {"acct:bob@example.com"}}, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := serveQuery(h, tt.method, tt.query)
+		if w.Code != tt.want {
+			t.Errorf("%s %v returned status %d, want %d", tt.method, tt.query, w.Code, tt.want)
+		}
+		if got, want := w.Header().Get("Access-Control-Allow-Origin"), "*"; got != want {
+			t.Errorf("%s %v returned Access-Control-Allow-Origin %q, want %q", tt.method, tt.query, got, want)
+		}
+	}
+}
+
+func TestHandler_cors(t *testing.T) {
+	h := NewHandler(testResolver)
+
+	req := httptest.NewRequest(http.MethodOptions, "/.well-known/webfinger?resource=acct%3Abob%40example.com", nil)
+	req.Header.Set("Origin", "https://app.example.org")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "Accept")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("OPTIONS returned status %d, want %d", w.Code, http.StatusNoContent)
+	}
+	wantHeaders := map[string]string{
+		"Access-Control-Allow-Origin":  "*",
+		"Access-Control-Allow-Methods": "GET, HEAD, OPTIONS",
+		"Access-Control-Allow-Headers": "Accept",
+	}
+	for name, want := range wantHeaders {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("OPTIONS returned %s %q, want %q", name, got, want)
+		}
+	}
+
+	h.AllowOrigin = "https://app.example.org"
+	w = serveQuery(h, http.MethodGet, url.Values{"resource": {"acct:bob@example.com"}})
+	if w.Code != http.StatusOK {
+		t.Errorf("GET returned status %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := w.Header().Get("Access-Control-Allow-Origin"), "https://app.example.org"; got != want {
+		t.Errorf("GET returned Access-Control-Allow-Origin %q, want %q", got, want)
+	}
+	if got, want := w.Header().Get("Vary"), "Origin"; got != want {
+		t.Errorf("GET returned Vary %q, want %q", got, want)
+	}
+}
+
+func TestHandler_client(t *testing.T) {
+	client, mux, host, teardown := setup()
+	defer teardown()
+	mux.Handle("/.well-known/webfinger", NewHandler(func(resource *Resource, rels []string) (*JRD, error) {
+		return &JRD{Subject: resource.String()}, nil
+	}))
+
+	jrd, err := client.Lookup("acct:bob@"+host, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error lookup up webfinger: %v", err)
+	}
+	if got, want := jrd.Subject, "acct:bob@"+host; got != want {
+		t.Errorf("Lookup returned subject %q, want %q", got, want)
+	}
+}
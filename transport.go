@@ -0,0 +1,91 @@
+package webfinger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/url"
+	"strconv"
+	"syscall"
+)
+
+// TransportMode controls whether a Client may use plain HTTP for WebFinger
+// queries.  The WebFinger spec requires all queries be made over HTTPS, so
+// modes other than HTTPSOnly should only ever be used for development.
+type TransportMode int
+
+const (
+	// HTTPSOnly sends queries over HTTPS only, and rejects redirects from
+	// HTTPS to HTTP.  It is the default.
+	HTTPSOnly TransportMode = iota
+
+	// HTTPSWithFallback sends queries over HTTPS, retrying them over HTTP if
+	// the HTTPS connection is refused, the server does not speak TLS, or its
+	// certificate cannot be verified.  Redirects to HTTP are followed.
+	HTTPSWithFallback
+
+	// HTTPOnly sends queries over plain HTTP, for development servers without
+	// TLS.  Redirects to HTTP are followed.
+	HTTPOnly
+)
+
+func (m TransportMode) String() string {
+	switch m {
+	case HTTPSOnly:
+		return "HTTPSOnly"
+	case HTTPSWithFallback:
+		return "HTTPSWithFallback"
+	case HTTPOnly:
+		return "HTTPOnly"
+	}
+	return "TransportMode(" + strconv.Itoa(int(m)) + ")"
+}
+
+// transportMode returns the client's effective transport mode, taking the
+// deprecated AllowHTTP field into account.
+func (c *Client) transportMode() TransportMode {
+	if c.TransportMode == HTTPSOnly && c.AllowHTTP {
+		return HTTPSWithFallback
+	}
+	return c.TransportMode
+}
+
+// scheme returns the URL scheme WebFinger queries are first sent with.
+func (c *Client) scheme() string {
+	if c.transportMode() == HTTPOnly {
+		return "http"
+	}
+	return "https"
+}
+
+// errSchemeMismatch is the text of the error returned by net/http when a
+// server answers an HTTPS request with plain HTTP.  Go 1.21 exports the error
+// as http.ErrSchemeMismatch, but earlier versions return an unexported error
+// with the same text, so it is matched by text.
+const errSchemeMismatch = "http: server gave HTTP response to HTTPS client"
+
+// isFallbackError reports whether err, returned for an HTTPS request,
+// indicates that the server may be reachable over plain HTTP: the connection
+// was refused, the server did not respond with TLS, or its certificate could
+// not be verified.
+func isFallbackError(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.As(err, &recordErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) ||
+		isSchemeMismatch(err)
+}
+
+// isSchemeMismatch reports whether err is the error returned by net/http
+// when a server answers an HTTPS request with plain HTTP.
+func isSchemeMismatch(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Err != nil && urlErr.Err.Error() == errSchemeMismatch
+}
@@ -0,0 +1,173 @@
+package webfinger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLookup_transportMode(t *testing.T) {
+	// a server that only speaks plain HTTP
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	resource := "acct:bob@" + u.Host
+
+	tests := []struct {
+		mode       TransportMode
+		allowHTTP  bool
+		wantErr    bool
+		wantScheme string
+	}{
+		{HTTPSOnly, false, true, "https"},
+		{HTTPSWithFallback, false, false, "https"},
+		{HTTPOnly, false, false, "http"},
+		{HTTPSOnly, true, false, "https"},
+	}
+
+	for _, tt := range tests {
+		client := NewClient(nil)
+		client.TransportMode = tt.mode
+		client.AllowHTTP = tt.allowHTTP
+
+		_, err := client.Lookup(resource, nil)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("Lookup with mode %v and AllowHTTP %v returned error %v, want error: %v", tt.mode, tt.allowHTTP, err, tt.wantErr)
+		}
+
+		planned, err := client.PlanLookup(resource, nil)
+		if err != nil {
+			t.Fatalf("PlanLookup returned error: %v", err)
+		}
+		if planned.Scheme != tt.wantScheme {
+			t.Errorf("PlanLookup with mode %v has scheme %q, want %q", tt.mode, planned.Scheme, tt.wantScheme)
+		}
+	}
+}
+
+func TestLookup_transportModeCertificateError(t *testing.T) {
+	// a TLS server whose certificate the client does not trust
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	resource := "acct:bob@" + u.Host
+
+	tests := []struct {
+		mode        TransportMode
+		wantSchemes []string
+	}{
+		{HTTPSOnly, []string{"https"}},
+		{HTTPSWithFallback, []string{"https", "http"}},
+	}
+
+	for _, tt := range tests {
+		client := NewClient(nil)
+		client.TransportMode = tt.mode
+		var mu sync.Mutex
+		var schemes []string
+		client.OnRequestStart = func(u *url.URL) {
+			mu.Lock()
+			schemes = append(schemes, u.Scheme)
+			mu.Unlock()
+		}
+
+		if _, err := client.Lookup(resource, nil); err == nil {
+			t.Errorf("Lookup with mode %v returned no error", tt.mode)
+		}
+		if !cmp.Equal(schemes, tt.wantSchemes) {
+			t.Errorf("Lookup with mode %v requested schemes %q, want %q", tt.mode, schemes, tt.wantSchemes)
+		}
+	}
+}
+
+func TestLookup_transportModeConnectionRefused(t *testing.T) {
+	// reserve a port, then close the listener so connections are refused
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen returned error: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	tests := []struct {
+		mode        TransportMode
+		wantSchemes []string
+	}{
+		{HTTPSOnly, []string{"https"}},
+		{HTTPSWithFallback, []string{"https", "http"}},
+	}
+
+	for _, tt := range tests {
+		client := NewClient(nil)
+		client.TransportMode = tt.mode
+		var schemes []string
+		client.OnRequestStart = func(u *url.URL) {
+			schemes = append(schemes, u.Scheme)
+		}
+
+		_, err := client.Lookup("acct:bob@"+addr, nil)
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Errorf("Lookup with mode %v returned %v, want ECONNREFUSED", tt.mode, err)
+		}
+		if !cmp.Equal(schemes, tt.wantSchemes) {
+			t.Errorf("Lookup with mode %v requested schemes %q, want %q", tt.mode, schemes, tt.wantSchemes)
+		}
+	}
+}
+
+func TestIsFallbackError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: fmt.Errorf("tls: failed to verify certificate: %w", x509.UnknownAuthorityError{})}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: x509.HostnameError{Host: "example.com"}}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: x509.CertificateInvalidError{Reason: x509.Expired}}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("http: server gave HTTP response to HTTPS client")}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNRESET}}}, false},
+		{errors.New("dial tcp: connection refused"), false},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("i/o timeout")}, false},
+		{ErrNotFound, false},
+	}
+	for _, tt := range tests {
+		if got := isFallbackError(tt.err); got != tt.want {
+			t.Errorf("isFallbackError(%v) returned %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestTransportMode_String(t *testing.T) {
+	tests := []struct {
+		mode TransportMode
+		want string
+	}{
+		{HTTPSOnly, "HTTPSOnly"},
+		{HTTPSWithFallback, "HTTPSWithFallback"},
+		{HTTPOnly, "HTTPOnly"},
+		{TransportMode(7), "TransportMode(7)"},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.String(); got != tt.want {
+			t.Errorf("String() returned %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Provides a simple XRD parser.
+//
+// Following the XRD 1.0 spec: http://docs.oasis-open.org/xri/xrd/v1.0/xrd-1.0.html
+// and the JRD mapping in http://tools.ietf.org/html/rfc6415#appendix-A
+
+package webfinger
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// xrdMediaType is the media type of an XRD document.
+const xrdMediaType = "application/xrd+xml"
+
+type xrd struct {
+	XMLName    xml.Name      `xml:"XRD"`
+	Subject    string        `xml:"Subject"`
+	Expires    *time.Time    `xml:"Expires"`
+	Aliases    []string      `xml:"Alias"`
+	Properties []xrdProperty `xml:"Property"`
+	Links      []xrdLink     `xml:"Link"`
+}
+
+type xrdProperty struct {
+	Type  string `xml:"type,attr"`
+	Nil   bool   `xml:"http://www.w3.org/2001/XMLSchema-instance nil,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xrdTitle struct {
+	Lang  string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xrdLink struct {
+	Rel        string        `xml:"rel,attr"`
+	Type       string        `xml:"type,attr"`
+	Href       string        `xml:"href,attr"`
+	Template   string        `xml:"template,attr"`
+	Titles     []xrdTitle    `xml:"Title"`
+	Properties []xrdProperty `xml:"Property"`
+}
+
+// ParseXRD parses an XRD document using xml.Unmarshal, returning its contents
+// as a JRD.  Titles without a language are stored under the "default" key,
+// and properties marked with xsi:nil are stored as null values.  As in the
+// JRD form, later titles and properties replace earlier ones of the same
+// language or type.
+func ParseXRD(blob []byte) (*JRD, error) {
+	doc := xrd{}
+	err := xml.Unmarshal(blob, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	jrd := &JRD{
+		Subject:    doc.Subject,
+		Expires:    doc.Expires,
+		Aliases:    doc.Aliases,
+		Properties: xrdProperties(doc.Properties),
+	}
+	for _, l := range doc.Links {
+		link := Link{
+			Rel:        l.Rel,
+			Type:       l.Type,
+			Href:       l.Href,
+			Template:   l.Template,
+			Properties: xrdProperties(l.Properties),
+		}
+		for _, title := range l.Titles {
+			if link.Titles == nil {
+				link.Titles = make(map[string]string)
+			}
+			lang := title.Lang
+			if lang == "" {
+				lang = "default"
+			}
+			link.Titles[lang] = title.Value
+		}
+		jrd.Links = append(jrd.Links, link)
+	}
+	return jrd, nil
+}
+
+// xrdProperties converts XRD Property elements to a JRD properties map.
+func xrdProperties(props []xrdProperty) map[string]interface{} {
+	if len(props) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(props))
+	for _, p := range props {
+		if p.Nil {
+			m[p.Type] = nil
+		} else {
+			m[p.Type] = p.Value
+		}
+	}
+	return m
+}
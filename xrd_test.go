@@ -0,0 +1,121 @@
+package webfinger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseXRD(t *testing.T) {
+	// Example XRD from http://tools.ietf.org/html/rfc6415#appendix-A
+	blob := `<?xml version='1.0' encoding='UTF-8'?>
+    <XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'
+         xmlns:xsi='http://www.w3.org/2001/XMLSchema-instance'>
+
+      <Subject>http://blog.example.com/article/id/314</Subject>
+      <Expires>2010-01-30T09:30:00Z</Expires>
+
+      <Alias>http://blog.example.com/cool_new_thing</Alias>
+      <Alias>http://blog.example.com/steve/article/7</Alias>
+
+      <Property type='http://blgx.example.net/ns/version'>1.2</Property>
+      <Property type='http://blgx.example.net/ns/version'>1.3</Property>
+      <Property type='http://blgx.example.net/ns/ext' xsi:nil='true' />
+
+      <Link rel='author' type='text/html'
+            href='http://blog.example.com/author/steve'>
+        <Title>About the Author</Title>
+        <Title xml:lang='en-us'>Author Information</Title>
+        <Property type='http://example.com/role'>editor</Property>
+      </Link>
+
+      <Link rel='author' href='http://example.com/author/john'>
+        <Title>The other guy</Title>
+        <Title>The other author</Title>
+      </Link>
+      <Link rel='copyright'
+            template='http://example.com/copyright?id={uri}' />
+    </XRD>
+    `
+	got, err := ParseXRD([]byte(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Date(2010, 01, 30, 9, 30, 0, 0, time.UTC)
+	want := &JRD{
+		Subject: "http://blog.example.com/article/id/314",
+		Expires: &expires,
+		Aliases: []string{
+			"http://blog.example.com/cool_new_thing",
+			"http://blog.example.com/steve/article/7",
+		},
+		Properties: map[string]interface{}{
+			"http://blgx.example.net/ns/version": "1.3",
+			"http://blgx.example.net/ns/ext":     nil,
+		},
+		Links: []Link{
+			{
+				Rel:  "author",
+				Type: "text/html",
+				Href: "http://blog.example.com/author/steve",
+				Titles: map[string]string{
+					"default": "About the Author",
+					"en-us":   "Author Information",
+				},
+				Properties: map[string]interface{}{
+					"http://example.com/role": "editor",
+				},
+			},
+			{
+				Rel:    "author",
+				Href:   "http://example.com/author/john",
+				Titles: map[string]string{"default": "The other author"},
+			},
+			{
+				Rel:      "copyright",
+				Template: "http://example.com/copyright?id={uri}",
+			},
+		},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("ParseXRD returned diff (-got +want):\n%s", cmp.Diff(got, want))
+	}
+	if got, want := got.GetProperty("http://blgx.example.net/ns/ext"), ""; got != want {
+		t.Errorf("GetProperty('http://blgx.example.net/ns/ext') returned %q, want %q", got, want)
+	}
+}
+
+func TestParseXRD_hostMeta(t *testing.T) {
+	// Example host-meta document from http://tools.ietf.org/html/rfc6415#section-1.1
+	blob := `<?xml version='1.0' encoding='UTF-8'?>
+    <XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>
+      <Link rel='copyright'
+            href='http://example.com/copyright' />
+      <Link rel='lrdd'
+            type='application/xrd+xml'
+            template='http://example.com/lrdd?uri={uri}' />
+    </XRD>
+    `
+	got, err := ParseXRD([]byte(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &JRD{
+		Links: []Link{
+			{Rel: "copyright", Href: "http://example.com/copyright"},
+			{Rel: "lrdd", Type: "application/xrd+xml", Template: "http://example.com/lrdd?uri={uri}"},
+		},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("ParseXRD returned %#v, want %#v", got, want)
+	}
+}
+
+func TestParseXRD_error(t *testing.T) {
+	_, err := ParseXRD([]byte("<XRD>"))
+	if err == nil {
+		t.Errorf("ParseXRD(<XRD>) did not return expected error")
+	}
+}